@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/s3"
+)
+
+// archive collects raw AWS API requests and responses of a single run along
+// with the report into gzipped tar, so that report can be verified later
+// against the data it was derived from.
+type archive struct {
+	bucket, prefix string
+	started        time.Time
+	signKey        ed25519.PrivateKey // if set, archive is signed
+
+	mu  sync.Mutex
+	n   int // number of API calls recorded
+	buf bytes.Buffer
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	err error // first error writing to archive
+}
+
+// newArchive returns archive to be stored at location in s3://bucket/prefix
+// form
+func newArchive(location string) (*archive, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid archive location %q, want s3://bucket/prefix", location)
+	}
+	a := &archive{
+		bucket:  u.Host,
+		prefix:  strings.Trim(u.Path, "/"),
+		started: time.Now().UTC(),
+	}
+	a.gz = gzip.NewWriter(&a.buf)
+	a.tw = tar.NewWriter(a.gz)
+	return a, nil
+}
+
+// add adds file to archive
+func (a *archive) add(name string, data []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if a.err = a.tw.WriteHeader(hdr); a.err == nil {
+		_, a.err = a.tw.Write(data)
+	}
+}
+
+// record adds API call request and response bodies to archive; calls are
+// numbered in order of their responses.
+func (a *archive) record(r *http.Request, reqBody, respBody []byte) {
+	a.mu.Lock()
+	a.n++
+	n := a.n
+	a.mu.Unlock()
+	service := "unknown"
+	if scope, err := credentialScope(r.Header.Get("Authorization")); err == nil {
+		service = strings.Split(scope, "/")[2]
+	}
+	name := fmt.Sprintf("api/%04d-%s", n, service)
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "%s %s\n", r.Method, r.URL)
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		fmt.Fprintf(&req, "X-Amz-Target: %s\n", target)
+	}
+	req.WriteString("\n")
+	req.Write(reqBody)
+	a.add(name+".request", req.Bytes())
+	a.add(name+".response", respBody)
+}
+
+// upload adds report to archive and stores it to S3
+func (a *archive) upload(report []byte, creds aws.CredentialsProvider, region string, client *http.Client) error {
+	a.add("report.txt", report)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if err := a.gz.Close(); err != nil {
+		return err
+	}
+	key := a.started.Format("20060102T150405Z") + "-" + region + ".tar.gz"
+	if a.prefix != "" {
+		key = a.prefix + "/" + key
+	}
+	_, err := s3.New(creds, region, client).PutObject(&s3.PutObjectRequest{
+		Bucket:        aws.String(a.bucket),
+		Key:           aws.String(key),
+		Body:          io.NopCloser(bytes.NewReader(a.buf.Bytes())),
+		ContentLength: aws.Long(int64(a.buf.Len())),
+		ContentType:   aws.String("application/gzip"),
+	})
+	if err != nil || a.signKey == nil {
+		return err
+	}
+	sig := sign(a.buf.Bytes(), a.signKey)
+	_, err = s3.New(creds, region, client).PutObject(&s3.PutObjectRequest{
+		Bucket:        aws.String(a.bucket),
+		Key:           aws.String(key + ".sig"),
+		Body:          io.NopCloser(bytes.NewReader(sig)),
+		ContentLength: aws.Long(int64(len(sig))),
+		ContentType:   aws.String("text/plain"),
+	})
+	return err
+}
+
+// archiveTransport records every request it makes and response it receives
+// to archive
+type archiveTransport struct {
+	next http.RoundTripper
+	a    *archive
+}
+
+func (t *archiveTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	t.a.record(r, reqBody, respBody)
+	return resp, nil
+}
+
+// teeStdout makes everything written to standard output also go to the
+// returned buffer, until returned function is called.
+func teeStdout() (*bytes.Buffer, func(), error) {
+	buf := new(bytes.Buffer)
+	restore, err := redirectStdout(io.MultiWriter(os.Stdout, buf))
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf, restore, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var asgfmt = "%30s\t%20s\t%d instances\t%s\n"
+
+// asgTag is set by Auto Scaling on instances it launches to group name
+const asgTag = "aws:autoscaling:groupName"
+
+// asgKey groups instances of Auto Scaling groups
+type asgKey struct {
+	Group string // Auto Scaling group name
+	Class string // instance class
+}
+
+// getDesiredCapacity returns desired capacity of Auto Scaling groups by their
+// names. Vendored aws-go has no Auto Scaling client, so requests are made
+// with the underlying query client directly.
+func getDesiredCapacity(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]int, error) {
+	endpoint, service, region := endpoints.Lookup("autoscaling", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	qc := &aws.QueryClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:     client,
+		Endpoint:   endpoint,
+		APIVersion: "2011-01-01",
+	}
+	req := &struct {
+		MaxRecords aws.IntegerValue `query:"MaxRecords"`
+		NextToken  aws.StringValue  `query:"NextToken"`
+	}{MaxRecords: aws.Integer(100)}
+	out := make(map[string]int)
+	for {
+		var resp struct {
+			Groups []struct {
+				Name    string `xml:"AutoScalingGroupName"`
+				Desired int    `xml:"DesiredCapacity"`
+			} `xml:"DescribeAutoScalingGroupsResult>AutoScalingGroups>member"`
+			NextToken string `xml:"DescribeAutoScalingGroupsResult>NextToken"`
+		}
+		if err := qc.Do("DescribeAutoScalingGroups", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, g := range resp.Groups {
+			out[g.Name] = g.Desired
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
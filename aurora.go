@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var aurorafmt = "%30s\t%18s\t%15s\t%2d writer\t%2d readers\t%2d reserved\n"
+
+// auroraCluster describes Aurora DB cluster and its member instances
+type auroraCluster struct {
+	ID      string `xml:"DBClusterIdentifier"`
+	Engine  string `xml:"Engine"`
+	Members []struct {
+		ID     string `xml:"DBInstanceIdentifier"`
+		Writer bool   `xml:"IsClusterWriter"`
+	} `xml:"DBClusterMembers>DBClusterMember"`
+}
+
+// getAuroraClusters returns Aurora DB clusters in region. Vendored rds
+// package predates DB clusters, so requests are made with the underlying
+// query client directly.
+func getAuroraClusters(creds aws.CredentialsProvider, region string, client *http.Client) ([]auroraCluster, error) {
+	endpoint, service, region := endpoints.Lookup("rds", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	qc := &aws.QueryClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:     client,
+		Endpoint:   endpoint,
+		APIVersion: "2014-10-31",
+	}
+	req := &struct {
+		Marker aws.StringValue `query:"Marker"`
+	}{}
+	var out []auroraCluster
+	for {
+		var resp struct {
+			Clusters []auroraCluster `xml:"DescribeDBClustersResult>DBClusters>DBCluster"`
+			Marker   string          `xml:"DescribeDBClustersResult>Marker"`
+		}
+		if err := qc.Do("DescribeDBClusters", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, c := range resp.Clusters {
+			// Multi-AZ DB clusters of other engines are listed too
+			if strings.HasPrefix(c.Engine, "aurora") {
+				out = append(out, c)
+			}
+		}
+		if resp.Marker == "" {
+			return out, nil
+		}
+		req.Marker = aws.String(resp.Marker)
+	}
+}
+
+// printAuroraCoverage prints instances of each Aurora cluster by class and
+// role, along with how many of them reservations cover. covered holds number
+// of running instances reservations cover, after size flexible ones were
+// settled; they're attributed to clusters in order of cluster names, writers
+// first.
+func printAuroraCoverage(clusters []auroraCluster, running []rdsInstInfo, covered map[rdsInst]int) {
+	byID := make(map[string]rdsInstInfo)
+	for _, ii := range running {
+		byID[ii.ID] = ii
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ID < clusters[j].ID })
+	left := make(map[rdsInst]int)
+	for k, v := range covered {
+		left[k] = v
+	}
+	headerPrinted := false
+	for _, c := range clusters {
+		members := c.Members
+		sort.SliceStable(members, func(i, j int) bool { return members[i].Writer && !members[j].Writer })
+		// writers, readers and covered instances by class
+		counts := make(map[string]*[3]int)
+		var classes []string
+		for _, m := range members {
+			ii, ok := byID[m.ID]
+			if !ok {
+				continue
+			}
+			n, ok := counts[ii.Class]
+			if !ok {
+				n = new([3]int)
+				counts[ii.Class] = n
+				classes = append(classes, ii.Class)
+			}
+			if m.Writer {
+				n[0]++
+			} else {
+				n[1]++
+			}
+			if left[ii.rdsInst] > 0 {
+				left[ii.rdsInst]--
+				n[2]++
+			}
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			if !headerPrinted {
+				headerPrinted = true
+				fmt.Println("\nAurora clusters:")
+			}
+			n := counts[class]
+			fmt.Printf(aurorafmt, c.ID, rdsProduct(c.Engine), class, n[0], n[1], n[2])
+		}
+	}
+}
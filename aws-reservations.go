@@ -4,7 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/artyom/autoflags"
 	"github.com/stripe/aws-go/aws"
@@ -13,137 +18,1694 @@ import (
 )
 
 var (
-	ec2fmt = "%20s\t%5s\t%d\n"
-	rdsfmt = "%20s\t%10s\t%9s\t%d\n"
+	ec2fmt     = "%20s\t%5s\t%s\t%s\t%d%s\n"
+	emrfmt     = "%20s\t%20s\t%d\n"
+	nrfmt      = "%20s\t%25s\t%d\n"
+	pendingfmt = "%20s\t%10s\t%d\t%s, starts %s\n"
+	stoppedfmt = "%20s\t%5s\t%s\t%s\t%12s\t%s%s\n"
+	rdsfmt     = "%20s\t%10s\t%9s\t%d\n"
+
+	rdsstoragefmt = "%20s\tstorage: %s\n"
+
+	recentfmt = "%12s\t%20s\t%20s\t%d\n"
 )
 
-func main() {
-	log.SetFlags(0)
-	config := struct {
-		AccessKey string `flag:"accesskey,access key (or use AWS_ACCESS_KEY_ID/AWS_ACCESS_KEY env.vars)"`
-		SecretKey string `flag:"secretkey,secret key (or use AWS_SECRET_ACCESS_KEY/AWS_SECRET_KEY env.vars)"`
-		Region    string `flag:"region,aws region"`
-	}{
-		Region: "us-west-1",
+// version is set at build time by release.go
+var version = "devel"
+
+func main() {
+	log.SetFlags(0)
+	config := struct {
+		AccessKey    string        `flag:"accesskey,access key (or use AWS_ACCESS_KEY_ID/AWS_ACCESS_KEY env.vars)"`
+		SecretKey    string        `flag:"secretkey,secret key (or use AWS_SECRET_ACCESS_KEY/AWS_SECRET_KEY env.vars)"`
+		Region       string        `flag:"region,aws region"`
+		Plan         string        `flag:"plan,csv file with planned EC2 fleet changes: date,region,class,count[,vpc]"`
+		Forecast     string        `flag:"forecast,report expected state on this date (YYYY-MM-DD), accounting for reservation expirations and -plan changes"`
+		Market       bool          `flag:"marketplace,show Reserved Instance Marketplace prices for unused EC2 reservations"`
+		Private      bool          `flag:"private-endpoints,use regional endpoint names only, so that requests go through VPC interface endpoints"`
+		FIPS         bool          `flag:"fips,use FIPS 140-2 validated endpoints"`
+		DualStack    bool          `flag:"dualstack,use dual-stack endpoints, needed to run from IPv6-only networks"`
+		Tag          string        `flag:"tag,only consider EC2 instances and reservations with this tag, as key=value or key"`
+		BusinessTag  string        `flag:"business-hours-tag,EC2 instances with this tag (key=value or key) only run during business hours, so they are suggested for scheduled stop/start rather than reservations"`
+		Recent       time.Duration `flag:"recent,alert on reservations purchased within this period that are already unused (0 to disable)"`
+		MatchTag     string        `flag:"match-tag,match EC2 reservations to instances having the same value of this tag first"`
+		Clusters     bool          `flag:"clusters,group EC2 instances by ECS or EKS cluster they are nodes of, detected by tags"`
+		Stopped      bool          `flag:"include-stopped,match stopped EC2 instances with reservations as if they were running"`
+		ExcludeEMR   bool          `flag:"exclude-emr,do not match EC2 instances of EMR clusters, which are usually short-lived, and list them separately"`
+		MediaLive    bool          `flag:"medialive,match running MediaLive channels with channel reservations"`
+		MultiAZFlex  bool          `flag:"multi-az-flex,let Multi-AZ RDS reservations cover two Single-AZ instances of the same class and engine, and two Single-AZ reservations cover one Multi-AZ instance"`
+		Graviton     bool          `flag:"graviton,compare reservation price of on-demand RDS instances of Intel classes with their Graviton equivalents"`
+		SavingsPlans bool          `flag:"savings-plans,take EC2 Savings Plans coverage from Cost Explorer into account (each run costs $0.01)"`
+		TFState      string        `flag:"tfstate,Terraform state file to compare EC2 instances and reservations with"`
+		Workers      int           `flag:"workers,number of AWS API calls to run concurrently"`
+		Roles        string        `flag:"roles,comma separated list of service=role-arn pairs, roles to assume for requests to these services (i.e. ce=arn:aws:iam::123456789012:role/billing)"`
+		ArchiveRaw   string        `flag:"archive-raw,store raw API responses and the report of this run to S3 location (i.e. s3://bucket/prefix)"`
+		SignKey      string        `flag:"sign-key,PEM file with Ed25519 private key to sign -archive-raw archive with, signature is stored next to it with .sig suffix"`
+		VerifyKey    string        `flag:"verify-key,PEM file with Ed25519 public key for verify command"`
+		Limit        int           `flag:"limit,show at most this many lines of each report section (0 for no limit)"`
+		Pager        bool          `flag:"pager,show report through $PAGER (less by default) when writing to terminal"`
+		ASGDesired   bool          `flag:"asg-desired,match desired capacity of Auto Scaling groups running instances of a single kind instead of their current number of instances; zonal reservations are still matched against running ones"`
+		Telemetry    string        `flag:"telemetry,URL to send anonymous usage data to: command, names of flags used, number of resources scanned and run duration, never resource identifiers (disabled by default; set it with AWS_RESERVATIONS_TELEMETRY env.var too; value off or DO_NOT_TRACK env.var disable it)"`
+		Endpoints    string        `flag:"endpoints,comma separated list of service=host endpoint overrides (i.e. ec2=vpce-123-abc.ec2.us-east-1.vpce.amazonaws.com)"`
+	}{
+		Region:  "us-west-1",
+		Recent:  7 * 24 * time.Hour,
+		Workers: 4,
+	}
+	autoflags.Define(&config)
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "", "reconcile", "selftest", "capacity", "risk":
+	case "verify":
+		// verify archive.tar.gz [signature], signature defaults to archive.tar.gz.sig
+		if config.VerifyKey == "" || flag.Arg(1) == "" {
+			log.Fatal("usage: verify -verify-key=key.pem archive.tar.gz [archive.tar.gz.sig]")
+		}
+		if err := verifyFile(config.VerifyKey, flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatal(flag.Arg(1), ": ", err)
+		}
+		fmt.Println(flag.Arg(1), "signature is valid")
+		return
+	case "version":
+		fmt.Println(version)
+		return
+	default:
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+	// usage report is sent on any exit, including fatal errors which skip
+	// deferred calls, so it's sent by fatal too; scanned is filled in once
+	// scans are done
+	telemetry := telemetryEndpoint(config.Telemetry)
+	started := time.Now()
+	scanned := make(map[string]int)
+	var usageOnce sync.Once
+	sendUsage := func() {
+		if telemetry == "" {
+			return
+		}
+		usageOnce.Do(func() {
+			if err := sendUsageReport(telemetry, newUsageReport(scanned, started)); err != nil {
+				log.Print("cannot send telemetry: ", err)
+			}
+		})
+	}
+	defer sendUsage()
+	fatal := func(v ...interface{}) {
+		sendUsage()
+		log.Fatal(v...)
+	}
+	creds, err := detectCreds(config.AccessKey, config.SecretKey)
+	if err != nil {
+		fatal(err)
+	}
+
+	hosts, err := parseServiceMap(config.Endpoints, "host")
+	if err != nil {
+		fatal(err)
+	}
+	endpointCfg := endpointConfig{
+		Hosts:     hosts,
+		Private:   config.Private,
+		FIPS:      config.FIPS,
+		DualStack: config.DualStack,
+	}
+	client := newHTTPClient(endpointCfg, creds)
+	roles, err := parseServiceMap(config.Roles, "role-arn")
+	if err != nil {
+		fatal(err)
+	}
+	rc, err := newRoleCreds(creds, roles, config.Region, client)
+	if err != nil {
+		fatal(err)
+	}
+	if len(roles) > 0 {
+		// roles are assumed using the client above, while other requests
+		// may be signed with role credentials
+		client = newHTTPClient(endpointCfg, rc.all()...)
+	}
+
+	if flag.Arg(0) == "selftest" {
+		if !selftest(rc, config.Region, client) {
+			sendUsage()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// set up before -archive-raw, so that archived report is kept in full
+	if config.Pager {
+		stop, err := startPager()
+		if err != nil {
+			fatal("cannot start pager: ", err)
+		}
+		defer stop()
+	}
+	if config.Limit > 0 {
+		restore, err := limitStdout(config.Limit)
+		if err != nil {
+			fatal(err)
+		}
+		defer restore()
+	}
+	if config.ArchiveRaw != "" {
+		a, err := newArchive(config.ArchiveRaw)
+		if err != nil {
+			fatal(err)
+		}
+		if config.SignKey != "" {
+			if a.signKey, err = loadSigningKey(config.SignKey); err != nil {
+				fatal(err)
+			}
+		}
+		report, restore, err := teeStdout()
+		if err != nil {
+			fatal(err)
+		}
+		uploadClient := client
+		at := &archiveTransport{next: http.DefaultTransport, a: a}
+		if client != nil && client.Transport != nil {
+			at.next = client.Transport
+		}
+		client = &http.Client{Transport: at}
+		defer func() {
+			restore()
+			if err := a.upload(report.Bytes(), rc.get("s3"), config.Region, uploadClient); err != nil {
+				fatal("cannot store archive: ", err)
+			}
+		}()
+	} else if config.SignKey != "" {
+		fatal("-sign-key requires -archive-raw")
+	}
+
+	tagFilter, err := parseTagFilter(config.Tag)
+	if err != nil {
+		fatal(err)
+	}
+	// zero filter matches everything, so it's only used with the flag set
+	businessFilter, err := parseTagFilter(config.BusinessTag)
+	if err != nil {
+		fatal(err)
+	}
+
+	var forecast time.Time
+	if config.Forecast != "" {
+		if forecast, err = time.Parse(dateLayout, config.Forecast); err != nil {
+			fatal("invalid -forecast value: ", err)
+		}
+	}
+	if config.Plan != "" && forecast.IsZero() {
+		fatal("-plan requires -forecast")
+	}
+	if config.MatchTag != "" && config.Clusters {
+		fatal("-match-tag and -clusters cannot be used together")
+	}
+	var declaredEi map[ec2Inst]int
+	if config.TFState != "" {
+		if declaredEi, err = readTerraformState(config.TFState, config.Region); err != nil {
+			fatal(err)
+		}
+	}
+
+	// asOf is the time coverage is reported for
+	asOf := forecast
+	if asOf.IsZero() {
+		asOf = time.Now()
+	}
+	// inEffect reports whether resource or reservation in state st applies
+	// by asOf: queued reservations only take effect on their start date,
+	// and reservations expiring by -forecast date are not counted
+	inEffect := func(st state, start, end time.Time) bool {
+		if st != Active && st != Pending || start.After(asOf) {
+			return false
+		}
+		return !expiresBy(end, forecast)
+	}
+	ec2Used := func(ii ec2InstInfo) bool {
+		if config.ExcludeEMR && ii.Tags[emrClusterTag] != "" {
+			return false
+		}
+		// spot instances never consume reservations
+		if ii.Spot {
+			return false
+		}
+		// stopped instances incur no compute charges, but may be
+		// started any time
+		active := inEffect(ii.State, ii.Start, ii.End) ||
+			config.Stopped && ii.Status == ec2.InstanceStateNameStopped
+		return active && tagFilter.match(ii.Tags)
+	}
+	rdsUsed := func(ii rdsInstInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	cacheUsed := func(ii cacheNodeInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	redshiftUsed := func(ii redshiftNodeInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	hostUsed := func(ii hostInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	memorydbUsed := func(ii memoryDBNodeInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	searchUsed := func(ii searchNodeInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	medialiveUsed := func(ii mediaLiveInfo) bool {
+		return inEffect(ii.State, ii.Start, ii.End)
+	}
+	// ec2Key returns key to match ii by, which includes tag value if
+	// -match-tag is used, or container cluster name with -clusters
+	ec2Key := func(ii ec2InstInfo) ec2Inst {
+		k := ii.ec2Inst
+		switch {
+		case config.MatchTag != "":
+			k.Tag = ii.Tags[config.MatchTag]
+		case config.Clusters:
+			k.Tag = containerCluster(ii.Tags)
+		}
+		return k
+	}
+
+	if id, err := getCallerIdentity(creds, config.Region, client); err != nil {
+		log.Print("cannot get caller identity: ", err)
+	} else {
+		fmt.Printf("Account %s (%s), region %s\n", id.Account, id.ARN, config.Region)
+	}
+
+	// isRecent reports whether reservation was purchased within -recent
+	// period
+	isRecent := func(start time.Time) bool {
+		return config.Recent > 0 && time.Since(start) < config.Recent
+	}
+
+	var (
+		runningEi, reservedEi []ec2InstInfo
+		runningRi, reservedRi []rdsInstInfo
+		runningCi, reservedCi []cacheNodeInfo
+		runningSi, reservedSi []redshiftNodeInfo
+		runningHi, reservedHi []hostInfo
+		runningMi, reservedMi []memoryDBNodeInfo
+		runningOi, reservedOi []searchNodeInfo
+
+		licensed        map[string][]string // license names by instance id
+		clusters        []auroraCluster
+		schedEi         []scheduledInstance
+		rsServerless    []serverlessWorkgroup
+		cacheServerless []serverlessCache
+		outposts        map[string]bool // subnet ids
+		instanceTypes   map[string]instanceType
+
+		cacheErr, cacheServerlessErr, redshiftErr, serverlessErr error
+		hostsErr, schedErr, outpostErr, licenseErr               error
+		auroraErr, memorydbErr, searchErr, typesErr              error
+	)
+	scans := []func() error{
+		func() (err error) {
+			runningEi, err = getRunningEC2Instances(rc.get("ec2"), config.Region, client)
+			return err
+		},
+		func() (err error) {
+			reservedEi, err = getReservedEC2Instances(rc.get("ec2"), config.Region, client)
+			return err
+		},
+		func() (err error) {
+			runningRi, err = getRunningRDSInstances(rc.get("rds"), config.Region, client)
+			return err
+		},
+		func() (err error) {
+			reservedRi, err = getReservedRDSInstances(rc.get("rds"), config.Region, client)
+			return err
+		},
+		// Aurora clusters, ElastiCache, ElastiCache Serverless, Redshift,
+		// Redshift Serverless, Outposts, Scheduled Reserved Instances, Dedicated Hosts, MemoryDB,
+		// OpenSearch, License Manager and instance types are optional, as older setups may not grant
+		// access to them, so their errors are handled below
+		func() error {
+			clusters, auroraErr = getAuroraClusters(rc.get("rds"), config.Region, client)
+			return nil
+		},
+		func() error {
+			runningCi, reservedCi, cacheErr = getElastiCacheNodes(rc.get("elasticache"), config.Region, client)
+			return nil
+		},
+		func() error {
+			cacheServerless, cacheServerlessErr = getServerlessCaches(rc.get("elasticache"), config.Region, client)
+			return nil
+		},
+		func() error {
+			runningSi, reservedSi, redshiftErr = getRedshiftNodes(rc.get("redshift"), config.Region, client)
+			return nil
+		},
+		func() error {
+			rsServerless, serverlessErr = getServerlessWorkgroups(rc.get("redshift-serverless"), rc.get("monitoring"), config.Region, client)
+			return nil
+		},
+		func() error {
+			outposts, outpostErr = getOutpostSubnets(rc.get("ec2"), config.Region, client)
+			return nil
+		},
+		func() error {
+			schedEi, schedErr = getScheduledInstances(rc.get("ec2"), config.Region, client)
+			return nil
+		},
+		func() error {
+			runningHi, reservedHi, hostsErr = getDedicatedHosts(rc.get("ec2"), config.Region, client)
+			return nil
+		},
+		func() error {
+			runningMi, reservedMi, memorydbErr = getMemoryDBNodes(rc.get("memorydb"), config.Region, client)
+			return nil
+		},
+		func() error {
+			runningOi, reservedOi, searchErr = getSearchNodes(rc.get("es"), config.Region, client)
+			return nil
+		},
+		func() error {
+			licensed, licenseErr = getLicensedInstances(rc.get("license-manager"), config.Region, client)
+			return nil
+		},
+		func() error {
+			instanceTypes, typesErr = getInstanceTypes(rc.get("ec2"), config.Region, client)
+			return nil
+		},
+	}
+	var (
+		savingsPlans      []savingsPlan
+		spCoverage        map[string]float64
+		spServiceCoverage map[string]spendCoverage
+		sageMakerUsage    spendUtilization
+		hasSageMakerPlans bool
+		sageMaker         map[sageMakerKey]int
+		fargate           fargateUsage
+		eksFargate        fargateUsage
+		lambda            lambdaUsage
+
+		spErr, fargateErr, eksFargateErr, lambdaErr, sageMakerErr error
+	)
+	if config.SavingsPlans {
+		// Savings Plans are optional too
+		scans = append(scans, func() error {
+			spErr = func() (err error) {
+				if savingsPlans, err = getSavingsPlans(rc.get("savingsplans"), client); err != nil {
+					return err
+				}
+				if spCoverage, err = getSavingsPlansCoverage(rc.get("ce"), config.Region, client); err != nil {
+					return err
+				}
+				if spServiceCoverage, err = getServiceCoverage(rc.get("ce"), config.Region, client); err != nil {
+					return err
+				}
+				for _, sp := range savingsPlans {
+					hasSageMakerPlans = hasSageMakerPlans || sp.Type == "SageMaker"
+				}
+				if hasSageMakerPlans {
+					sageMakerUsage, err = getSavingsPlansUtilization(rc.get("ce"), client, "SAGEMAKER_SP")
+				}
+				return err
+			}()
+			return nil
+		}, func() error {
+			sageMaker, sageMakerErr = getSageMakerUsage(rc.get("sagemaker"), config.Region, client)
+			return nil
+		}, func() error {
+			fargate, fargateErr = getFargateUsage(rc.get("ecs"), config.Region, client)
+			return nil
+		}, func() error {
+			eksFargate, eksFargateErr = getEKSFargateUsage(rc.get("eks"), config.Region, client)
+			return nil
+		}, func() error {
+			lambda, lambdaErr = getLambdaUsage(rc.get("lambda"), rc.get("monitoring"), config.Region, client)
+			return nil
+		})
+	}
+	var (
+		runningLi, reservedLi []mediaLiveInfo
+		medialiveErr          error
+	)
+	if config.MediaLive {
+		// MediaLive is optional too
+		scans = append(scans, func() error {
+			runningLi, reservedLi, medialiveErr = getMediaLive(rc.get("medialive"), config.Region, client)
+			return nil
+		})
+	}
+	var (
+		desired map[string]int // Auto Scaling group desired capacity
+		asgErr  error
+	)
+	if config.ASGDesired {
+		// Auto Scaling is optional too
+		scans = append(scans, func() error {
+			desired, asgErr = getDesiredCapacity(rc.get("autoscaling"), config.Region, client)
+			return nil
+		})
+	}
+	var (
+		capacity []capacityReservation
+		fleets   []capacityFleet
+	)
+	if flag.Arg(0) == "capacity" {
+		scans = append(scans,
+			func() (err error) {
+				capacity, err = getCapacityReservations(rc.get("ec2"), config.Region, client)
+				return err
+			},
+			func() (err error) {
+				fleets, err = getCapacityFleets(rc.get("ec2"), config.Region, client)
+				return err
+			},
+		)
+	}
+	err = runScans(config.Workers, scans...)
+	for name, n := range map[string]int{
+		"ec2":            len(runningEi),
+		"ec2-ri":         len(reservedEi),
+		"rds":            len(runningRi),
+		"rds-ri":         len(reservedRi),
+		"elasticache":    len(runningCi),
+		"elasticache-ri": len(reservedCi),
+		"redshift":       len(runningSi),
+		"redshift-ri":    len(reservedSi),
+		"hosts":          len(runningHi),
+		"hosts-ri":       len(reservedHi),
+		"memorydb":       len(runningMi),
+		"memorydb-ri":    len(reservedMi),
+		"opensearch":     len(runningOi),
+		"opensearch-ri":  len(reservedOi),
+		"medialive":      len(runningLi),
+		"medialive-ri":   len(reservedLi),
+	} {
+		scanned[name] = n
+	}
+	if err != nil {
+		fatal(err)
+	}
+	// optional report sections skipped due to missing permissions
+	var skipped []string
+	for name, err := range map[string]error{
+		"ElastiCache":                  cacheErr,
+		"Redshift":                     redshiftErr,
+		"Redshift Serverless":          serverlessErr,
+		"ElastiCache Serverless":       cacheServerlessErr,
+		"Aurora clusters":              auroraErr,
+		"Dedicated Hosts":              hostsErr,
+		"Outposts placement":           outpostErr,
+		"Scheduled Reserved Instances": schedErr,
+		"Savings Plans":                spErr,
+		"Fargate tasks":                fargateErr,
+		"EKS Fargate pods":             eksFargateErr,
+		"Lambda usage":                 lambdaErr,
+		"SageMaker usage":              sageMakerErr,
+		"MediaLive":                    medialiveErr,
+		"Auto Scaling groups":          asgErr,
+		"License Manager":              licenseErr,
+		"MemoryDB":                     memorydbErr,
+		"OpenSearch":                   searchErr,
+		"Instance types":               typesErr,
+	} {
+		if isAccessDenied(err) {
+			skipped = append(skipped, name)
+		} else if err != nil {
+			fatal(err)
+		}
+	}
+	sort.Strings(skipped)
+
+	ei := make(map[ec2Inst]int)
+	ri := make(map[rdsInst]int)
+	ci := make(map[cacheNode]int)
+	si := make(map[redshiftNode]int)
+	hi := make(map[hostGroup]int)
+	mi := make(map[memoryDBNode]int)
+	oi := make(map[searchNode]int)
+	li := make(map[mediaLiveKey]int)
+	// number of recently purchased reservations, by key
+	recentEi := make(map[ec2Inst]int)
+	recentRi := make(map[rdsInst]int)
+	recentCi := make(map[cacheNode]int)
+	recentSi := make(map[redshiftNode]int)
+	recentHi := make(map[hostGroup]int)
+	recentMi := make(map[memoryDBNode]int)
+	recentOi := make(map[searchNode]int)
+	recentLi := make(map[mediaLiveKey]int)
+
+	// at first fill ei, ri, ci, si, hi and mi with running instances info, then subtract
+	// reserved instances info from this data
+	// instances on Outposts and in Local or Wavelength Zones can't be
+	// covered by reservations, so they're set aside
+	notReservable := make(map[placementKey]int)
+	// instances of Auto Scaling groups, by group name
+	asgEi := make(map[string][]ec2InstInfo)
+	// instances and reservations which can be matched across sizes of the
+	// same family
+	flexRun := make(map[ec2Inst]int)
+	flexRes := make(map[ec2Inst]int)
+	// zonal reservations only apply to instances in their zone, so they're
+	// matched by zone first; zoneEi holds instances by zone, then zonal
+	// reservations left unused
+	zoneEi := make(map[zonalKey]int)
+	recentZoneEi := make(map[zonalKey]int)
+	// number of reservations of each offering class, by key
+	offeringClasses := make(map[ec2Inst]map[string]int)
+	for _, ii := range runningEi {
+		if !ec2Used(ii) {
+			continue
+		}
+		switch {
+		case outposts[ii.Subnet]:
+			notReservable[placementKey{Class: ii.Class, Placement: "outpost " + ii.Zone}] += ii.Count
+			continue
+		case isLocalZone(ii.Zone, config.Region):
+			notReservable[placementKey{Class: ii.Class, Placement: ii.Zone}] += ii.Count
+			continue
+		}
+		ei[ec2Key(ii)] += ii.Count
+		zoneEi[newZonalKey(ec2Key(ii), ii.Zone)] += ii.Count
+		if ii.Platform == "" && ii.Tenancy == "" {
+			flexRun[ec2Key(ii)] += ii.Count
+		}
+		if g := ii.Tags[asgTag]; g != "" {
+			asgEi[g] = append(asgEi[g], ii)
+		}
+	}
+	// number of instances of Auto Scaling groups fluctuates, so with
+	// -asg-desired their desired capacity is matched instead; this is only
+	// done for groups running instances of a single kind, as it's not known
+	// what kind of instances group would add or remove otherwise. Zones of
+	// instances group would add or remove are not known either, so zonal
+	// reservations are still matched against running instances only.
+	for g, list := range asgEi {
+		n, ok := desired[g]
+		if !ok {
+			continue
+		}
+		k, running := ec2Key(list[0]), 0
+		for _, ii := range list {
+			if ec2Key(ii) != k {
+				running = -1
+				break
+			}
+			running += ii.Count
+		}
+		if running >= 0 {
+			ei[k] += n - running
+			if list[0].Platform == "" && list[0].Tenancy == "" {
+				flexRun[k] += n - running
+			}
+		}
+	}
+	if config.Plan != "" {
+		changes, err := readPlan(config.Plan)
+		if err != nil {
+			fatal(err)
+		}
+		for _, c := range changes {
+			if c.Region != config.Region || c.Date.After(forecast) {
+				continue
+			}
+			ei[c.ec2Inst] += c.Count
+			if c.Platform == "" && c.Tenancy == "" {
+				flexRun[c.ec2Inst] += c.Count
+			}
+		}
+	}
+	for _, ii := range runningRi {
+		if !rdsUsed(ii) {
+			continue
+		}
+		ri[ii.rdsInst] += ii.Count
+	}
+
+	for _, ii := range reservedEi {
+		if !ec2Used(ii) {
+			continue
+		}
+		if offeringClasses[ec2Key(ii)] == nil {
+			offeringClasses[ec2Key(ii)] = make(map[string]int)
+		}
+		offeringClasses[ec2Key(ii)][ii.OfferingClass] += ii.Count
+		if ii.Zone != "" {
+			zk := newZonalKey(ec2Key(ii), ii.Zone)
+			n := minInt(ii.Count, zoneEi[zk])
+			if n < 0 {
+				n = 0
+			}
+			ei[ec2Key(ii)] -= n
+			zoneEi[zk] -= ii.Count
+			if isRecent(ii.Start) {
+				recentZoneEi[zk] += ii.Count
+			}
+			continue
+		}
+		ei[ec2Key(ii)] -= ii.Count
+		if ii.Flexible {
+			flexRes[ec2Key(ii)] += ii.Count
+		}
+		if isRecent(ii.Start) {
+			recentEi[ec2Key(ii)] += ii.Count
+		}
+	}
+	if config.MatchTag != "" || config.Clusters {
+		settleTagGroups(ei)
+	}
+	flexLeft := settleSizeFlexible(ei, flexRun, flexRes)
+	// Savings Plans apply to usage left after reservations; spEi holds
+	// instances they cover
+	spEi := make(map[ec2Inst]int)
+	for k, v := range ei {
+		if v < 1 || spErr != nil {
+			continue
+		}
+		n := int(float64(v)*spCoverage[instanceFamily(k.Class)] + 0.5)
+		ei[k] -= n
+		spEi[k] = n
+	}
+	// business hours instances are the last to be covered, whatever is left
+	// of them is not worth reserving for full time; bhEi holds them
+	bhEi := make(map[ec2Inst]int)
+	if config.BusinessTag != "" {
+		for _, ii := range runningEi {
+			if !ec2Used(ii) || !businessFilter.match(ii.Tags) || ei[ec2Key(ii)] < 1 {
+				continue
+			}
+			// Outposts and Local Zones instances were never counted in ei
+			if outposts[ii.Subnet] || isLocalZone(ii.Zone, config.Region) {
+				continue
+			}
+			n := ii.Count
+			if ei[ec2Key(ii)] < n {
+				n = ei[ec2Key(ii)]
+			}
+			ei[ec2Key(ii)] -= n
+			bhEi[ec2Key(ii)] += n
+		}
+	}
+	for _, ii := range reservedRi {
+		if !rdsUsed(ii) {
+			continue
+		}
+		ri[ii.rdsInst] -= ii.Count
+		if isRecent(ii.Start) {
+			recentRi[ii.rdsInst] += ii.Count
+		}
+	}
+	rdsFlexLeft := settleRDSSizeFlexible(ri, config.MultiAZFlex)
+
+	for _, ii := range runningCi {
+		if !cacheUsed(ii) {
+			continue
+		}
+		ci[ii.cacheNode] += ii.Count
+	}
+	for _, ii := range reservedCi {
+		if !cacheUsed(ii) {
+			continue
+		}
+		ci[ii.cacheNode] -= ii.Count
+		if isRecent(ii.Start) {
+			recentCi[ii.cacheNode] += ii.Count
+		}
+	}
+
+	for _, ii := range runningSi {
+		if !redshiftUsed(ii) {
+			continue
+		}
+		si[ii.redshiftNode] += ii.Count
+	}
+	for _, ii := range reservedSi {
+		if !redshiftUsed(ii) {
+			continue
+		}
+		si[ii.redshiftNode] -= ii.Count
+		if isRecent(ii.Start) {
+			recentSi[ii.redshiftNode] += ii.Count
+		}
+	}
+
+	for _, ii := range runningHi {
+		if !hostUsed(ii) {
+			continue
+		}
+		hi[ii.hostGroup] += ii.Count
+	}
+	for _, ii := range reservedHi {
+		if !hostUsed(ii) {
+			continue
+		}
+		hi[ii.hostGroup] -= ii.Count
+		if isRecent(ii.Start) {
+			recentHi[ii.hostGroup] += ii.Count
+		}
+	}
+
+	for _, ii := range runningMi {
+		if !memorydbUsed(ii) {
+			continue
+		}
+		mi[ii.memoryDBNode] += ii.Count
+	}
+	for _, ii := range reservedMi {
+		if !memorydbUsed(ii) {
+			continue
+		}
+		mi[ii.memoryDBNode] -= ii.Count
+		if isRecent(ii.Start) {
+			recentMi[ii.memoryDBNode] += ii.Count
+		}
+	}
+
+	for _, ii := range runningOi {
+		if !searchUsed(ii) || !ii.reservable() {
+			continue
+		}
+		oi[ii.searchNode] += ii.Count
+	}
+	for _, ii := range reservedOi {
+		if !searchUsed(ii) {
+			continue
+		}
+		oi[ii.searchNode] -= ii.Count
+		if isRecent(ii.Start) {
+			recentOi[ii.searchNode] += ii.Count
+		}
+	}
+
+	for _, ii := range runningLi {
+		if !medialiveUsed(ii) {
+			continue
+		}
+		li[ii.mediaLiveKey] += ii.Count
+	}
+	// input and output reservations are reported as is, holding them
+	// separately
+	var ioLi []mediaLiveInfo
+	for _, ii := range reservedLi {
+		if !medialiveUsed(ii) {
+			continue
+		}
+		if ii.Resource != "CHANNEL" {
+			ioLi = append(ioLi, ii)
+			continue
+		}
+		li[ii.mediaLiveKey] -= ii.Count
+		if isRecent(ii.Start) {
+			recentLi[ii.mediaLiveKey] += ii.Count
+		}
+	}
+
+	if flag.Arg(0) == "reconcile" {
+		printReconcile(ec2Used, rdsUsed, cacheUsed, redshiftUsed, hostUsed, memorydbUsed, searchUsed,
+			runningEi, reservedEi, runningRi, reservedRi,
+			runningCi, reservedCi, runningSi, reservedSi,
+			runningHi, reservedHi, runningMi, reservedMi, runningOi, reservedOi)
+		return
+	}
+	if flag.Arg(0) == "capacity" {
+		printCapacity(ec2Used, runningEi, capacity, fleets, forecast)
+		return
+	}
+	if flag.Arg(0) == "risk" {
+		var commitments []commitment
+		usage := []reservationUsage{{Service: "EC2"}, {Service: "RDS"}}
+		for _, ii := range reservedEi {
+			if ec2Used(ii) {
+				commitments = append(commitments, commitment{Service: "EC2", Family: instanceFamily(ii.Class),
+					Count: ii.Count, Hourly: ii.Hourly, End: ii.End})
+				usage[0].Total += ii.Count
+			}
+		}
+		for _, ii := range reservedRi {
+			if rdsUsed(ii) {
+				commitments = append(commitments, commitment{Service: "RDS", Family: rdsInstanceFamily(ii.Class),
+					Count: ii.Count, Hourly: ii.Hourly, End: ii.End})
+				usage[1].Total += ii.Count
+			}
+		}
+		for _, v := range ei {
+			if v < 0 {
+				usage[0].Unused -= v
+			}
+		}
+		for _, v := range zoneEi {
+			if v < 0 {
+				usage[0].Unused -= v
+			}
+		}
+		for _, v := range ri {
+			if v < 0 {
+				usage[1].Unused -= v
+			}
+		}
+		printRisk(commitments, usage, time.Now())
+		return
+	}
+
+	if !forecast.IsZero() {
+		fmt.Println("Forecast for", forecast.Format(dateLayout))
+	}
+	// reservations bought recently and already unused are likely
+	// purchased by mistake (wrong region, class or platform), so they're
+	// reported first
+	headerPrinted := false
+	printRecent := func(service, class, details string, n int) {
+		if n < 1 {
+			return
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Printf("\nWARNING: reservations purchased within %v have no matching usage:\n", config.Recent)
+		}
+		fmt.Printf(recentfmt, service, class, details, n)
+	}
+	for k, v := range ei {
+		details := stringVPC(k.VPC) + " " + stringPlatform(k.Platform)
+		if k.Tenancy != "" {
+			details += " " + k.Tenancy
+		}
+		if k.Tag != "" {
+			details += " " + k.Tag
+		}
+		printRecent("EC2", k.Class, details, recentUnused(v, recentEi[k]))
+	}
+	for k, v := range zoneEi {
+		details := stringVPC(k.VPC) + " " + stringPlatform(k.Platform) + " " + k.Zone
+		if k.Tenancy != "" {
+			details += " " + k.Tenancy
+		}
+		if k.Tag != "" {
+			details += " " + k.Tag
+		}
+		printRecent("EC2", k.Class, details, recentUnused(v, recentZoneEi[k]))
+	}
+	for k, v := range ri {
+		printRecent(rdsFamily(k.Product), k.Class, strings.TrimSpace(rdsDescription(k)+" "+stringMultiAZ(k.MultiAZ)), recentUnused(v, recentRi[k]))
+	}
+	for k, v := range ci {
+		printRecent("ElastiCache", k.Class, k.Product, recentUnused(v, recentCi[k]))
+	}
+	for k, v := range si {
+		printRecent("Redshift", k.Class, "", recentUnused(v, recentSi[k]))
+	}
+	for k, v := range hi {
+		printRecent("Dedicated Host", k.Family, k.Zone, recentUnused(v, recentHi[k]))
+	}
+	for k, v := range mi {
+		printRecent("MemoryDB", k.Class, "", recentUnused(v, recentMi[k]))
+	}
+	for k, v := range oi {
+		printRecent("OpenSearch", k.Class, "", recentUnused(v, recentOi[k]))
+	}
+	for k, v := range li {
+		printRecent("MediaLive", k.Codec+" "+k.Resolution, k.Bitrate+" "+k.Class, recentUnused(v, recentLi[k]))
+	}
+
+	headerPrinted = false
+	// only print active instances without matching reservations
+	for k, v := range ei {
+		if v < 1 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand EC2 instances:")
+		}
+		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), v, stringTag(k.Tag))
+	}
+	// on-demand instances of previous generation classes are better moved
+	// to newer classes, which usually cost less, than reserved as is
+	prevGen := make(map[string]int)
+	for k, v := range ei {
+		if t, ok := instanceTypes[k.Class]; ok && v > 0 && !t.CurrentGeneration {
+			prevGen[k.Class] += v
+		}
+	}
+	headerPrinted = false
+	for class, v := range prevGen {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand EC2 instances of previous generation classes:")
+		}
+		t := instanceTypes[class]
+		fmt.Printf(prevgenfmt, class, t.VCPUs, float64(t.MemoryMiB)/1024, v, stringNewerClass(newerClass(instanceTypes, class)))
+	}
+	headerPrinted = false
+	for k, v := range bhEi {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand business hours EC2 instances, schedule stop/start rather than reserve:")
+		}
+		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), v, stringTag(k.Tag))
+	}
+	stoppedEi := make(map[ec2Inst]int)
+	for _, ii := range runningEi {
+		if !config.Stopped && !ii.Spot && ii.Status == ec2.InstanceStateNameStopped && tagFilter.match(ii.Tags) {
+			stoppedEi[ec2Key(ii)] += ii.Count
+		}
+	}
+	headerPrinted = false
+	for k, v := range stoppedEi {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nStopped EC2 instances, not matched (use -include-stopped to match them):")
+		}
+		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), v, stringTag(k.Tag))
+	}
+	spotEi := make(map[ec2Inst]int)
+	for _, ii := range runningEi {
+		if ii.Spot && ii.State == Active && tagFilter.match(ii.Tags) {
+			spotEi[ec2Key(ii)] += ii.Count
+		}
+	}
+	headerPrinted = false
+	for k, v := range spotEi {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nSpot EC2 instances, not matched:")
+		}
+		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), v, stringTag(k.Tag))
+	}
+	asgCount := make(map[asgKey]int)
+	for _, list := range asgEi {
+		for _, ii := range list {
+			asgCount[asgKey{Group: ii.Tags[asgTag], Class: ii.Class}] += ii.Count
+		}
+	}
+	headerPrinted = false
+	for k, v := range asgCount {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nEC2 instances of Auto Scaling groups:")
+		}
+		var details string
+		if n, ok := desired[k.Group]; ok {
+			details = fmt.Sprintf("%d desired", n)
+		}
+		fmt.Printf(asgfmt, k.Group, k.Class, v, details)
+	}
+	// EMR cluster instances excluded with -exclude-emr
+	emr := make(map[emrKey]int)
+	for _, ii := range runningEi {
+		if !config.ExcludeEMR || ii.State != Active || !tagFilter.match(ii.Tags) {
+			continue
+		}
+		if id := ii.Tags[emrClusterTag]; id != "" {
+			emr[emrKey{Class: ii.Class, Cluster: id}] += ii.Count
+		}
+	}
+	headerPrinted = false
+	for k, v := range emr {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nEC2 instances of EMR clusters, not matched:")
+		}
+		fmt.Printf(emrfmt, k.Class, k.Cluster, v)
+	}
+	headerPrinted = false
+	for k, v := range notReservable {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nNot reservable EC2 instances (Outposts, Local and Wavelength Zones):")
+		}
+		fmt.Printf(nrfmt, k.Class, k.Placement, v)
+	}
+	// reservations not active yet are counted as coverage, but listed so
+	// that it's clear coverage is forthcoming
+	headerPrinted = false
+	for _, ii := range reservedEi {
+		if ii.State != Pending || !ec2Used(ii) {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nForthcoming EC2 reservations, counted as coverage:")
+		}
+		fmt.Printf(pendingfmt, ii.Class, stringVPC(ii.VPC), ii.Count, ii.Status, ii.Start.Format(dateLayout))
+	}
+	// only print reserved instances without matching running instances
+	headerPrinted = false
+	for k, v := range ei {
+		if v >= 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused EC2 reservations (standard ones can be sold on Marketplace, convertible ones exchanged):")
+		}
+		fmt.Printf(unusedfmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), -v,
+			stringOfferingClasses(offeringClasses[k]), stringTag(k.Tag))
+	}
+	headerPrinted = false
+	for k, v := range zoneEi {
+		if v >= 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused zonal EC2 reservations (only apply in their zone):")
+		}
+		fmt.Printf(zonalfmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), k.Zone, -v,
+			stringOfferingClasses(offeringClasses[k.ec2Inst]), stringTag(k.Tag))
+	}
+	// stopped instances unused reservations would cover, up to the number
+	// of reservations left, as starting them costs nothing extra
+	headerPrinted = false
+	freeEi := make(map[ec2Inst]int)
+	freeZoneEi := make(map[zonalKey]int)
+	for _, ii := range runningEi {
+		if config.Stopped || ii.Spot || ii.Status != ec2.InstanceStateNameStopped || !tagFilter.match(ii.Tags) {
+			continue
+		}
+		k := ec2Key(ii)
+		zk := newZonalKey(k, ii.Zone)
+		switch {
+		case freeZoneEi[zk] < -zoneEi[zk]:
+			freeZoneEi[zk]++
+		case freeEi[k] < -ei[k]:
+			freeEi[k]++
+		default:
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nStopped EC2 instances unused reservations would cover:")
+		}
+		fmt.Printf(stoppedfmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), ii.Zone, ii.ID, stringTag(k.Tag))
+	}
+	headerPrinted = false
+	for _, l := range flexLeft {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nSize-flexible EC2 reservations partially applied:")
+		}
+		fmt.Printf(flexfmt, l.Class, stringVPC(l.VPC), l.Fraction, stringLeftover(l.Covered),
+			stringTag(l.Tag), stringFlexSuggestion(instanceTypes, l))
+	}
+	// for unused reservations show what comparable ones sell for
+	headerPrinted = false
+	for k, v := range ei {
+		if v >= 0 || !config.Market {
+			continue
+		}
+		st, err := getMarketStats(rc.get("ec2"), config.Region, client, k)
+		if isAccessDenied(err) {
+			skipped = append(skipped, "Marketplace listings for unused EC2 reservations")
+			break
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nMarketplace listings for unused EC2 reservations:")
+		}
+		if st.Listings == 0 {
+			fmt.Printf("%20s\t%5s\t%s\t%s\tno listings\n", k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy))
+			continue
+		}
+		fmt.Printf(marketfmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), st.Listings,
+			st.MinPrice, st.MedianPrice, st.MedianMonths)
+	}
+	// scheduled instances only cover their recurring time slots, so they
+	// are not matched with instances running around the clock
+	headerPrinted = false
+	for _, s := range schedEi {
+		if !s.End.After(time.Now()) || expiresBy(s.End, forecast) {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nScheduled Reserved Instances (not matched with running instances):")
+		}
+		fmt.Printf(scheduledfmt, s.Class, s.Zone, s.Count, s.schedule(), s.End.Format(dateLayout))
+	}
+
+	headerPrinted = false
+	for k, v := range spEi {
+		if v < 1 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nEC2 instances covered by Savings Plans (estimated from yesterday's spend):")
+		}
+		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), stringPlatform(k.Platform), stringTenancy(k.Tenancy), v, stringTag(k.Tag))
+	}
+	headerPrinted = false
+	for _, sp := range savingsPlans {
+		// EC2 Instance Savings Plans only apply in their region
+		if sp.Type == "SageMaker" || sp.Region != "" && sp.Region != config.Region {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nActive Savings Plans:")
+		}
+		fmt.Printf(spfmt, sp.Type, sp.Family, sp.Commitment, sp.End)
+	}
+	headerPrinted = false
+	for _, service := range spServices {
+		c, ok := spServiceCoverage[service]
+		if !ok {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nSavings Plans coverage of other services yesterday, USD:")
+		}
+		fmt.Printf(spcoveragefmt, service, c.Covered, c.OnDemand)
+	}
+	if fargate.Tasks > 0 || eksFargate.Tasks > 0 {
+		fmt.Println("\nRunning Fargate tasks and pods, eligible for Compute Savings Plans:")
+	}
+	if fargate.Tasks > 0 {
+		fmt.Printf(fargatefmt, "ECS", fargate.Tasks, fargate.VCPU, fargate.Memory)
+	}
+	if eksFargate.Tasks > 0 {
+		fmt.Printf(eksfargatefmt, "EKS", eksFargate.Tasks, eksFargate.VCPU, eksFargate.Memory)
+	}
+	if lambda.Functions > 0 {
+		fmt.Println("\nLambda usage yesterday, eligible for Compute Savings Plans:")
+		fmt.Printf(lambdafmt, "Lambda", lambda.Functions, lambda.GBSeconds)
+	}
+	if len(sageMaker) > 0 {
+		if hasSageMakerPlans {
+			fmt.Println("\nRunning SageMaker instances, eligible for SageMaker Savings Plans:")
+		} else {
+			fmt.Println("\nRunning SageMaker instances, not covered as there are no SageMaker Savings Plans:")
+		}
+		keys := make([]sageMakerKey, 0, len(sageMaker))
+		for k := range sageMaker {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].Component != keys[j].Component {
+				return keys[i].Component < keys[j].Component
+			}
+			return keys[i].Class < keys[j].Class
+		})
+		for _, k := range keys {
+			fmt.Printf(sagemakerfmt, k.Component, k.Class, sageMaker[k])
+		}
+	}
+	if hasSageMakerPlans {
+		fmt.Println("\nSageMaker Savings Plans commitment yesterday, USD:")
+		fmt.Printf(sputilfmt, "SageMaker", sageMakerUsage.Used, sageMakerUsage.Unused)
+	}
+
+	// reservations apply to instances bringing their own licenses as to any
+	// other, but with licensing dominating their cost they may be better
+	// off on Dedicated Hosts or different instance classes, so they're
+	// listed separately
+	byol := make(map[byolKey]int)
+	for _, ii := range runningEi {
+		if !ec2Used(ii) {
+			continue
+		}
+		for _, name := range licensed[ii.ID] {
+			byol[byolKey{Class: ii.Class, License: name}] += ii.Count
+		}
+	}
+	headerPrinted = false
+	for k, v := range byol {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nEC2 instances using licenses tracked by License Manager (BYOL):")
+		}
+		fmt.Printf(byolfmt, k.Class, k.License, v)
 	}
-	autoflags.Define(&config)
-	flag.Parse()
-	creds := aws.DetectCreds(config.AccessKey, config.SecretKey, "")
 
-	ei := make(map[ec2Inst]int)
-	ri := make(map[rdsInst]int)
+	if declaredEi != nil {
+		// Terraform state does not tell instance platform, so live
+		// instances and reservations are compared regardless of it
+		driftKey := func(ii ec2InstInfo) ec2Inst {
+			k := ii.ec2Inst
+			k.Platform = ""
+			return k
+		}
+		live := make(map[ec2Inst]int)
+		for _, ii := range runningEi {
+			if ec2Used(ii) {
+				live[driftKey(ii)] += ii.Count
+			}
+		}
+		reserved := make(map[ec2Inst]int)
+		for _, ii := range reservedEi {
+			if ec2Used(ii) {
+				reserved[driftKey(ii)] += ii.Count
+			}
+		}
+		printDrift(declaredEi, live, reserved)
+	}
 
-	// at first fill ei and ri with running instances info, then subtract
-	// reserved instances info from this data
-	runningEi, err := getRunningEC2Instances(creds, config.Region)
-	if err != nil {
-		log.Fatal(err)
+	headerPrinted = false
+	for _, ii := range reservedRi {
+		if ii.State != Pending || !rdsUsed(ii) {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nForthcoming RDS reservations, counted as coverage:")
+		}
+		fmt.Printf(pendingfmt, ii.Class, rdsDescription(ii.rdsInst), ii.Count, ii.Status, ii.Start.Format(dateLayout))
 	}
-	for _, ii := range runningEi {
-		if ii.State != Active {
+
+	// DocumentDB and Neptune are managed through RDS API, but are reported
+	// on their own
+	for _, family := range []string{"RDS", "DocumentDB", "Neptune"} {
+		// only print active instances without matching reservations
+		headerPrinted = false
+		for k, v := range ri {
+			if v < 1 || rdsFamily(k.Product) != family {
+				continue
+			}
+			if !headerPrinted {
+				headerPrinted = true
+				fmt.Printf("\nOn-demand %s instances:\n", family)
+			}
+			fmt.Printf(rdsfmt, k.Class, rdsDescription(k), stringMultiAZ(k.MultiAZ), v)
+			// storage can't be reserved, but matters when deciding what
+			// to reserve or resize; it's shown for all instances of the
+			// kind, as it's not known which of them reservations apply to
+			var same []rdsInstInfo
+			for _, ii := range runningRi {
+				if ii.rdsInst == k && rdsUsed(ii) {
+					same = append(same, ii)
+				}
+			}
+			if s := rdsStorageSummary(same); s != "" {
+				fmt.Printf(rdsstoragefmt, "", s)
+			}
+		}
+		// only print reservations without matching active instances
+		headerPrinted = false
+		for k, v := range ri {
+			if v >= 0 || rdsFamily(k.Product) != family {
+				continue
+			}
+			if !headerPrinted {
+				headerPrinted = true
+				fmt.Printf("\nUnused %s reservation:\n", family)
+			}
+			fmt.Printf(rdsfmt, k.Class, rdsDescription(k), stringMultiAZ(k.MultiAZ), -v)
+		}
+	}
+	headerPrinted = false
+	for _, l := range rdsFlexLeft {
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nSize-flexible RDS reservations partially applied:")
+		}
+		fmt.Printf(rdsflexfmt, l.Class, rdsDescription(l.rdsInst), stringMultiAZ(l.MultiAZ), l.Fraction, stringLeftover(l.Covered))
+	}
+	// for on-demand instances of Intel classes show whether moving to
+	// Graviton before reserving is worth it
+	headerPrinted = false
+	for k, v := range ri {
+		graviton := gravitonClass(k.Class)
+		if v < 1 || graviton == "" || !config.Graviton {
+			continue
+		}
+		price, ok, err := getRDSReservationPrice(rc.get("rds"), config.Region, client, k)
+		if isAccessDenied(err) {
+			skipped = append(skipped, "RDS reservation prices")
+			break
+		}
+		if err != nil {
+			fatal(err)
+		}
+		g := k
+		g.Class = graviton
+		gPrice, gOk, err := getRDSReservationPrice(rc.get("rds"), config.Region, client, g)
+		if isAccessDenied(err) {
+			skipped = append(skipped, "RDS reservation prices")
+			break
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if !ok || !gOk {
 			continue
 		}
-		ei[ii.ec2Inst] += ii.Count
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nReserving on-demand RDS instances as is or on Graviton (1 year, No Upfront):")
+		}
+		fmt.Printf(gravitonfmt, k.Class, rdsDescription(k), stringMultiAZ(k.MultiAZ), v,
+			price*hoursPerMonth*float64(v), graviton, gPrice*hoursPerMonth*float64(v))
 	}
-	runningRi, err := getRunningRDSInstances(creds, config.Region)
-	if err != nil {
-		log.Fatal(err)
+	if len(clusters) > 0 {
+		var running []rdsInstInfo
+		for _, ii := range runningRi {
+			if rdsUsed(ii) {
+				running = append(running, ii)
+			}
+		}
+		// instances covered are the ones not left on-demand in ri, so
+		// that size flexible reservations are accounted as they were
+		// settled above
+		covered := make(map[rdsInst]int)
+		for _, ii := range running {
+			covered[ii.rdsInst] += ii.Count
+		}
+		for k := range covered {
+			if ri[k] > 0 {
+				covered[k] -= ri[k]
+			}
+		}
+		printAuroraCoverage(clusters, running, covered)
 	}
-	for _, ii := range runningRi {
-		if ii.State != Active {
+
+	// only print ElastiCache nodes without matching reservations
+	headerPrinted = false
+	for k, v := range ci {
+		if v < 1 {
 			continue
 		}
-		ri[ii.rdsInst] += ii.Count
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand ElastiCache nodes:")
+		}
+		fmt.Printf(cachefmt, k.Class, k.Product, v)
+	}
+	// only print reserved ElastiCache nodes without matching nodes
+	headerPrinted = false
+	for k, v := range ci {
+		if v >= 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused ElastiCache reservations:")
+		}
+		fmt.Printf(cachefmt, k.Class, k.Product, -v)
+	}
+	if len(cacheServerless) > 0 {
+		fmt.Println("\nElastiCache Serverless caches:")
+		serverless := make(map[string]bool) // by engine
+		for _, c := range cacheServerless {
+			fmt.Printf(serverlesscachefmt, c.Name, c.Engine, c.Status)
+			serverless[c.Engine] = true
+		}
+		// reserved nodes only apply to node-based clusters, so ones
+		// left after workload moved to serverless are stranded
+		for k, v := range ci {
+			if v < 0 && serverless[k.Product] {
+				fmt.Printf("WARNING: %d unused %s %s reserved nodes cannot cover Serverless caches\n", -v, k.Class, k.Product)
+			}
+		}
 	}
 
-	reservedEi, err := getReservedEC2Instances(creds, config.Region)
-	if err != nil {
-		log.Fatal(err)
+	headerPrinted = false
+	for _, ii := range runningSi {
+		if !ii.resizing() || !redshiftUsed(ii) {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nRedshift clusters scheduled for resize (matched by target nodes):")
+		}
+		fmt.Printf(redshiftresizefmt, ii.ID, ii.FromClass, ii.FromCount, ii.Class, ii.Count)
 	}
-	for _, ii := range reservedEi {
-		if ii.State != Active {
+	// only print Redshift nodes without matching reservations
+	headerPrinted = false
+	for k, v := range si {
+		if v < 1 {
 			continue
 		}
-		ei[ii.ec2Inst] -= ii.Count
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand Redshift nodes:")
+		}
+		fmt.Printf(redshiftfmt, k.Class, v)
 	}
-	reservedRi, err := getReservedRDSInstances(creds, config.Region)
-	if err != nil {
-		log.Fatal(err)
+	// only print reserved Redshift nodes without matching nodes
+	headerPrinted = false
+	for k, v := range si {
+		if v >= 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused Redshift reservations:")
+		}
+		fmt.Printf(redshiftfmt, k.Class, -v)
 	}
-	for _, ii := range reservedRi {
-		if ii.State != Active {
+	// reserved nodes of older types are only of use to clusters moved to RA3
+	// if exchanged, as they only apply to the same node type
+	var ra3OnDemand bool
+	for k, v := range si {
+		if v > 0 && strings.HasPrefix(k.Class, "ra3.") {
+			ra3OnDemand = true
+		}
+	}
+	for k, v := range si {
+		if v < 0 && ra3OnDemand && exchangeableForRA3(k.Class) {
+			fmt.Printf("WARNING: %d unused %s reserved nodes can be exchanged for RA3 ones to cover on-demand RA3 nodes\n", -v, k.Class)
+		}
+	}
+	if len(rsServerless) > 0 {
+		fmt.Println("\nRedshift Serverless workgroups, usage yesterday:")
+		for _, w := range rsServerless {
+			fmt.Printf(serverlessfmt, w.Name, w.BaseRPU, w.RPUHours)
+		}
+		// reserved nodes only apply to provisioned clusters; headerPrinted
+		// is still set if there are unused Redshift reservations
+		if headerPrinted {
+			fmt.Println("WARNING: unused Redshift reservations cannot cover Serverless workgroups")
+		}
+	}
+
+	// only print Dedicated Hosts without matching host reservations
+	headerPrinted = false
+	for k, v := range hi {
+		if v < 1 {
 			continue
 		}
-		ri[ii.rdsInst] -= ii.Count
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand Dedicated Hosts:")
+		}
+		fmt.Printf(hostfmt, k.Family, k.Zone, v)
+	}
+	// only print host reservations without matching hosts
+	headerPrinted = false
+	for k, v := range hi {
+		if v >= 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused Dedicated Host reservations:")
+		}
+		fmt.Printf(hostfmt, k.Family, k.Zone, -v)
+	}
+	// Mac hosts are billed for at least 24 hours after allocation, even
+	// if released, so recently allocated ones are costly to replace with
+	// reserved ones right away
+	headerPrinted = false
+	for _, ii := range runningHi {
+		release := ii.Allocated.Add(macMinAllocation)
+		if !ii.isMac() || !hostUsed(ii) || ii.Allocated.IsZero() || !time.Now().Before(release) {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nMac Dedicated Hosts within 24-hour minimum allocation period:")
+		}
+		fmt.Printf(machostfmt, ii.Family, ii.Zone, release.UTC().Format(time.RFC3339))
 	}
 
-	headerPrinted := false
-	// only print active instances without matching reservations
-	for k, v := range ei {
+	// only print MemoryDB nodes without matching reservations
+	headerPrinted = false
+	for k, v := range mi {
 		if v < 1 {
 			continue
 		}
 		if !headerPrinted {
 			headerPrinted = true
-			fmt.Println("\nOn-demand EC2 instances:")
+			fmt.Println("\nOn-demand MemoryDB nodes:")
 		}
-		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), v)
+		fmt.Printf(memorydbfmt, k.Class, v)
 	}
-	// only print reserved instances without matching running instances
+	// only print reserved MemoryDB nodes without matching nodes
 	headerPrinted = false
-	for k, v := range ei {
+	for k, v := range mi {
 		if v >= 0 {
 			continue
 		}
 		if !headerPrinted {
 			headerPrinted = true
-			fmt.Println("\nUnused EC2 reservations:")
+			fmt.Println("\nUnused MemoryDB reservations:")
 		}
-		fmt.Printf(ec2fmt, k.Class, stringVPC(k.VPC), -v)
+		fmt.Printf(memorydbfmt, k.Class, -v)
 	}
 
-	// only print active RDS instances without matching reservations
+	// OpenSearch nodes of all kinds are listed, as data and dedicated
+	// master nodes of the same class are matched together, and UltraWarm
+	// nodes and cold storage are not matched at all
+	searchKinds := make(map[searchKindKey]int)
+	for _, ii := range runningOi {
+		if searchUsed(ii) {
+			searchKinds[searchKindKey{Kind: ii.Kind, Class: ii.Class}] += ii.Count
+		}
+	}
+	if len(searchKinds) > 0 {
+		keys := make([]searchKindKey, 0, len(searchKinds))
+		for k := range searchKinds {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].Kind != keys[j].Kind {
+				return searchKindOrder(keys[i].Kind) < searchKindOrder(keys[j].Kind)
+			}
+			return keys[i].Class < keys[j].Class
+		})
+		fmt.Println("\nOpenSearch nodes by kind (UltraWarm and cold storage are not reservable):")
+		for _, k := range keys {
+			if k.Kind == searchCold {
+				fmt.Printf(searchcoldfmt, "-", k.Kind, searchKinds[k])
+				continue
+			}
+			fmt.Printf(searchkindfmt, k.Class, k.Kind, searchKinds[k])
+		}
+	}
+	// only print OpenSearch nodes without matching reservations
 	headerPrinted = false
-	for k, v := range ri {
+	for k, v := range oi {
 		if v < 1 {
 			continue
 		}
 		if !headerPrinted {
 			headerPrinted = true
-			fmt.Println("\nOn-demand RDS instances:")
+			fmt.Println("\nOn-demand OpenSearch nodes:")
 		}
-		fmt.Printf(rdsfmt, k.Class, k.Product, stringMultiAZ(k.MultiAZ), v)
+		fmt.Printf(searchfmt, k.Class, v)
 	}
-	// only print reserved RDS instances without matching active instances
+	// only print reserved OpenSearch nodes without matching nodes
 	headerPrinted = false
-	for k, v := range ri {
+	for k, v := range oi {
 		if v >= 0 {
 			continue
 		}
 		if !headerPrinted {
 			headerPrinted = true
-			fmt.Println("\nUnused RDS reservation:")
+			fmt.Println("\nUnused OpenSearch reservations:")
 		}
-		fmt.Printf(rdsfmt, k.Class, k.Product, stringMultiAZ(k.MultiAZ), -v)
+		fmt.Printf(searchfmt, k.Class, -v)
 	}
-}
 
-func getRunningEC2Instances(creds aws.CredentialsProvider, region string) ([]ec2InstInfo, error) {
-	resp, err := ec2.New(creds, region, nil).DescribeInstances(nil)
-	if err != nil {
-		return nil, err
+	// only print MediaLive channels without matching reservations
+	headerPrinted = false
+	for k, v := range li {
+		if v < 1 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nOn-demand MediaLive channels:")
+		}
+		fmt.Printf(medialivefmt, k.Resource, k.Codec, k.Resolution, k.Bitrate, k.Class, v)
+	}
+	// only print channel reservations without matching channels
+	headerPrinted = false
+	for k, v := range li {
+		if v >= 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused MediaLive reservations:")
+		}
+		fmt.Printf(medialivefmt, k.Resource, k.Codec, k.Resolution, k.Bitrate, k.Class, -v)
+	}
+	if len(ioLi) > 0 {
+		fmt.Println("\nMediaLive input and output reservations, not matched:")
+		for _, ii := range ioLi {
+			fmt.Printf(medialivefmt, ii.Resource, ii.Codec, ii.Resolution, ii.Bitrate, ii.Class, ii.Count)
+		}
+	}
+
+	// reservations of other services not active yet are counted as
+	// coverage too, as EC2 and RDS ones are
+	type forthcoming struct {
+		Service, Class string
+		Count          int
+		Status         string
+		Start          time.Time
+	}
+	var pendingOther []forthcoming
+	for _, ii := range reservedCi {
+		if ii.State == Pending && cacheUsed(ii) {
+			pendingOther = append(pendingOther, forthcoming{"ElastiCache", ii.Class, ii.Count, ii.Status, ii.Start})
+		}
+	}
+	for _, ii := range reservedSi {
+		if ii.State == Pending && redshiftUsed(ii) {
+			pendingOther = append(pendingOther, forthcoming{"Redshift", ii.Class, ii.Count, ii.Status, ii.Start})
+		}
+	}
+	for _, ii := range reservedHi {
+		if ii.State == Pending && hostUsed(ii) {
+			pendingOther = append(pendingOther, forthcoming{"Host", ii.Family, ii.Count, ii.Status, ii.Start})
+		}
+	}
+	for _, ii := range reservedMi {
+		if ii.State == Pending && memorydbUsed(ii) {
+			pendingOther = append(pendingOther, forthcoming{"MemoryDB", ii.Class, ii.Count, ii.Status, ii.Start})
+		}
+	}
+	for _, ii := range reservedOi {
+		if ii.State == Pending && searchUsed(ii) {
+			pendingOther = append(pendingOther, forthcoming{"OpenSearch", ii.Class, ii.Count, ii.Status, ii.Start})
+		}
+	}
+	for _, ii := range reservedLi {
+		if ii.State == Pending && medialiveUsed(ii) {
+			pendingOther = append(pendingOther, forthcoming{"MediaLive", ii.Resource + " " + ii.Class, ii.Count, ii.Status, ii.Start})
+		}
 	}
+	if len(pendingOther) > 0 {
+		fmt.Println("\nForthcoming reservations of other services, counted as coverage:")
+		for _, f := range pendingOther {
+			fmt.Printf(pendingfmt, f.Class, f.Service, f.Count, f.Status, f.Start.Format(dateLayout))
+		}
+	}
+
+	if len(skipped) > 0 {
+		fmt.Println("\nSkipped due to missing permissions:")
+		for _, name := range skipped {
+			fmt.Println("\t" + name)
+		}
+	}
+}
+
+func getRunningEC2Instances(creds aws.CredentialsProvider, region string, client *http.Client) ([]ec2InstInfo, error) {
+	c := newEC2Client(creds, region, client)
+	req := &describePage{MaxResults: aws.Integer(1000)}
 	var out []ec2InstInfo
-	for _, r := range resp.Reservations {
-		for _, inst := range r.Instances {
+	for {
+		var resp struct {
+			Instances []ec2Instance `xml:"reservationSet>item>instancesSet>item"`
+			NextToken string        `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeInstances", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, inst := range resp.Instances {
 			out = append(out, ec2iToec2ii(inst))
 		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
 	}
-	return out, nil
 }
 
-func getRunningRDSInstances(creds aws.CredentialsProvider, region string) ([]rdsInstInfo, error) {
-	resp, err := rds.New(creds, region, nil).DescribeDBInstances(nil)
+func getRunningRDSInstances(creds aws.CredentialsProvider, region string, client *http.Client) ([]rdsInstInfo, error) {
+	resp, err := rds.New(creds, region, client).DescribeDBInstances(nil)
 	if err != nil {
 		return nil, err
 	}
@@ -154,8 +1716,8 @@ func getRunningRDSInstances(creds aws.CredentialsProvider, region string) ([]rds
 	return out, nil
 }
 
-func getReservedRDSInstances(creds aws.CredentialsProvider, region string) ([]rdsInstInfo, error) {
-	resp, err := rds.New(creds, region, nil).DescribeReservedDBInstances(nil)
+func getReservedRDSInstances(creds aws.CredentialsProvider, region string, client *http.Client) ([]rdsInstInfo, error) {
+	resp, err := rds.New(creds, region, client).DescribeReservedDBInstances(nil)
 	if err != nil {
 		return nil, err
 	}
@@ -166,14 +1728,20 @@ func getReservedRDSInstances(creds aws.CredentialsProvider, region string) ([]rd
 	return out, nil
 }
 
-func getReservedEC2Instances(creds aws.CredentialsProvider, region string) ([]ec2InstInfo, error) {
-	resp, err := ec2.New(creds, region, nil).DescribeReservedInstances(nil)
+func getReservedEC2Instances(creds aws.CredentialsProvider, region string, client *http.Client) ([]ec2InstInfo, error) {
+	resp, err := ec2.New(creds, region, client).DescribeReservedInstances(nil)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := getOfferingClasses(creds, region, client)
 	if err != nil {
 		return nil, err
 	}
 	var out []ec2InstInfo
 	for _, r := range resp.ReservedInstances {
-		out = append(out, ec2riToec2ii(r))
+		ii := ec2riToec2ii(r)
+		ii.OfferingClass = classes[toStr(r.ReservedInstancesID)]
+		out = append(out, ii)
 	}
 	return out, nil
 }
@@ -183,53 +1751,141 @@ func getReservedEC2Instances(creds aws.CredentialsProvider, region string) ([]ec
 func rdsiTordsii(r rds.DBInstance) rdsInstInfo {
 	out := rdsInstInfo{
 		rdsInst: rdsInst{
-			Class:   toStr(r.DBInstanceClass),
-			Product: toStr(r.Engine),
-			MultiAZ: toBool(r.MultiAZ),
+			Class:        toStr(r.DBInstanceClass),
+			Product:      rdsProduct(toStr(r.Engine)),
+			LicenseModel: rdsLicenseModel(toStr(r.LicenseModel)),
+			MultiAZ:      toBool(r.MultiAZ),
 		},
-		Count: 1,
-		State: Active,
+		Count:       1,
+		State:       Active,
+		Status:      toStr(r.DBInstanceStatus),
+		ID:          toStr(r.DBInstanceIdentifier),
+		Storage:     toInt(r.AllocatedStorage),
+		StorageType: toStr(r.StorageType),
+		IOPS:        toInt(r.IOPS),
 	}
-	if out.Product == "postgres" {
-		out.Product = "postgresql"
+	if strings.HasPrefix(out.Product, "aurora") {
+		// instances share cluster volume and report placeholder storage
+		out.Storage, out.IOPS = 0, 0
 	}
 	return out
 }
 
-// rdsriTordsii converts rds.ReservedDBInstance to rdsInstInfo
+// rdsProduct returns product description reservations for instances of
+// engine have. Aurora MySQL 5.6 instances use "aurora" engine name, while
+// their reservations are the same as for later versions.
+func rdsProduct(engine string) string {
+	switch engine {
+	case "postgres":
+		return "postgresql"
+	case "aurora":
+		return "aurora-mysql"
+	}
+	return engine
+}
+
+// rdsLicenseModel returns license model of instance as reservations name it
+// in their product description (i.e. "li" for "license-included"), or empty
+// string for engines with a single license model
+func rdsLicenseModel(model string) string {
+	switch model {
+	case "license-included":
+		return "li"
+	case "bring-your-own-license":
+		return "byol"
+	}
+	return ""
+}
+
+// rdsDescription returns product description reservations for instances of k
+// have, i.e. "oracle-ee(byol)"
+func rdsDescription(k rdsInst) string {
+	if k.LicenseModel == "" {
+		return k.Product
+	}
+	return k.Product + "(" + k.LicenseModel + ")"
+}
+
+// rdsriTordsii converts rds.ReservedDBInstance to rdsInstInfo. Product
+// description of Oracle and SQL Server reservations includes license model,
+// i.e. "sqlserver-se(li)", which is kept separately.
 func rdsriTordsii(r rds.ReservedDBInstance) rdsInstInfo {
+	product, license := toStr(r.ProductDescription), ""
+	if i := strings.IndexByte(product, '('); i > 0 && strings.HasSuffix(product, ")") {
+		product, license = product[:i], product[i+1:len(product)-1]
+	}
 	out := rdsInstInfo{
 		rdsInst: rdsInst{
-			Class:   toStr(r.DBInstanceClass),
-			Product: toStr(r.ProductDescription),
-			MultiAZ: toBool(r.MultiAZ),
+			Class:        toStr(r.DBInstanceClass),
+			Product:      product,
+			LicenseModel: license,
+			MultiAZ:      toBool(r.MultiAZ),
 		},
-		Count: toInt(r.DBInstanceCount),
+		Count:  toInt(r.DBInstanceCount),
+		Status: toStr(r.State),
+		Start:  r.StartTime,
+		End:    r.StartTime.Add(time.Duration(toInt(r.Duration)) * time.Second),
+		Hourly: toDouble(r.UsagePrice),
+	}
+	for _, c := range r.RecurringCharges {
+		if toStr(c.RecurringChargeFrequency) == "Hourly" {
+			out.Hourly += toDouble(c.RecurringChargeAmount)
+		}
 	}
 	switch toStr(r.State) {
 	case "active":
 		out.State = Active
+	case "payment-pending":
+		out.State = Pending
 	}
 	return out
 }
 
-// ec2iToec2ii converts ec2.Instance to ec2InstInfo. Count is always set to 1,
-// State set to Active for all known states except for the terminated.
-func ec2iToec2ii(r ec2.Instance) ec2InstInfo {
+// ec2Instance is an item of DescribeInstances response. Vendored ec2 package
+// predates platform details, so instances are described with the underlying
+// ec2 client directly.
+type ec2Instance struct {
+	ID                string    `xml:"instanceId"`
+	Class             string    `xml:"instanceType"`
+	VPCID             string    `xml:"vpcId"`
+	SubnetID          string    `xml:"subnetId"`
+	Zone              string    `xml:"placement>availabilityZone"`
+	Tenancy           string    `xml:"placement>tenancy"`
+	State             string    `xml:"instanceState>name"`
+	InstanceLifecycle string    `xml:"instanceLifecycle"`
+	PlatformDetails   string    `xml:"platformDetails"`
+	Platform          string    `xml:"platform"` // "windows" or empty
+	Tags              []ec2.Tag `xml:"tagSet>item"`
+}
+
+// ec2iToec2ii converts ec2Instance to ec2InstInfo. Count is always set to 1,
+// State is set to Active only for running and pending instances, any other
+// state (i.e. stopped) is left as UnknownState and kept in Status.
+func ec2iToec2ii(r ec2Instance) ec2InstInfo {
 	out := ec2InstInfo{
 		ec2Inst: ec2Inst{
-			Class: toStr(r.InstanceType),
-			VPC:   len(toStr(r.VPCID)) > 0,
+			Class:    r.Class,
+			VPC:      r.VPCID != "",
+			Platform: ec2Platform(r.PlatformDetails),
+			Tenancy:  ec2Tenancy(r.Tenancy),
 		},
-		Count: 1,
-		State: UnknownState,
+		Count:  1,
+		State:  UnknownState,
+		Status: r.State,
+		Tags:   tagMap(r.Tags),
+		Zone:   r.Zone,
+		ID:     r.ID,
+		Subnet: r.SubnetID,
+		Spot:   r.InstanceLifecycle == ec2.InstanceLifecycleTypeSpot,
 	}
-	if r.State != nil {
-		switch toStr(r.State.Name) {
-		case ec2.InstanceStateNameRunning,
-			ec2.InstanceStateNamePending:
-			out.State = Active
-		}
+	// platform details may be missing for instances just launched
+	if r.PlatformDetails == "" && r.Platform == "windows" {
+		out.Platform = "Windows"
+	}
+	switch out.Status {
+	case ec2.InstanceStateNameRunning,
+		ec2.InstanceStateNamePending:
+		out.State = Active
 	}
 	return out
 }
@@ -240,12 +1896,30 @@ func ec2riToec2ii(r ec2.ReservedInstances) ec2InstInfo {
 		ec2Inst: ec2Inst{
 			Class: toStr(r.InstanceType),
 		},
-		Count: toInt(r.InstanceCount),
+		Count:  toInt(r.InstanceCount),
+		Status: toStr(r.State),
+		Start:  r.Start,
+		End:    r.End,
+		Tags:   tagMap(r.Tags),
 	}
 	out.VPC = strings.Contains(toStr(r.ProductDescription), "Amazon VPC")
+	out.Zone = toStr(r.AvailabilityZone)
+	out.Platform = ec2Platform(toStr(r.ProductDescription))
+	out.Tenancy = ec2Tenancy(toStr(r.InstanceTenancy))
+	if r.UsagePrice != nil {
+		out.Hourly = float64(*r.UsagePrice)
+	}
+	for _, c := range r.RecurringCharges {
+		if toStr(c.Frequency) == "Hourly" {
+			out.Hourly += toDouble(c.Amount)
+		}
+	}
+	out.Flexible = out.Zone == "" && out.Platform == "" && out.Tenancy == ""
 	switch toStr(r.State) {
 	case "active":
 		out.State = Active
+	case "payment-pending", "queued":
+		out.State = Pending
 	}
 	return out
 }
@@ -253,28 +1927,60 @@ func ec2riToec2ii(r ec2.ReservedInstances) ec2InstInfo {
 // ec2InstInfo describes a group of ec2 instances having the same state
 type ec2InstInfo struct {
 	ec2Inst
-	Count int   // number of instances in group
-	State state // state of instances in group
+	Count  int               // number of instances in group
+	State  state             // state of instances in group
+	Status string            // state as reported by AWS
+	Start  time.Time         // reservation start time, zero for instances
+	End    time.Time         // reservation end time, zero for instances
+	Tags   map[string]string // instance or reservation tags
+	Zone   string            // availability zone, empty for regional reservations
+
+	// reservation details, only set for reservations
+	Flexible      bool    // regional Linux/UNIX reservation with default tenancy, applies to any size of its family
+	OfferingClass string  // standard or convertible
+	Hourly        float64 // hourly charges of single reserved instance, USD
+
+	// instance details, only set for instances
+	ID     string // instance id
+	Subnet string // subnet id, empty outside of VPC
+	Spot   bool   // spot instance
 }
 
 // ec2Inst describes single ec2 instance
 type ec2Inst struct {
-	Class string // instance class (i.e. m3.large)
-	VPC   bool   // instance belongs to VPC
+	Class    string // instance class (i.e. m3.large)
+	VPC      bool   // instance belongs to VPC
+	Platform string // platform as named by reservations (i.e. Windows), empty for Linux/UNIX
+	Tenancy  string // dedicated or host, empty for default
+	Tag      string // value of the -match-tag tag, if used
 }
 
 // rdsInstInfo describes a group of RDS instances having the same state
 type rdsInstInfo struct {
 	rdsInst
-	Count int   // number of instances in group
-	State state // state of instances in group
+	Count  int       // number of instances in group
+	State  state     // state of instances in group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for instances
+	End    time.Time // reservation end time, zero for instances
+
+	// instance details, only set for instances; storage is not
+	// reservable
+	ID          string // instance identifier
+	Storage     int    // allocated storage, GB
+	StorageType string // standard, gp2, io1, etc.
+	IOPS        int    // provisioned IOPS, if any
+
+	// reservation details, only set for reservations
+	Hourly float64 // hourly charges of single reserved instance, USD
 }
 
 // rdsInst describes single RDS instance
 type rdsInst struct {
-	Class   string // instance class (i.e. db.m3.large)
-	Product string // type of database (mysql, postgres)
-	MultiAZ bool   // instance spans multiple availability zones
+	Class        string // instance class (i.e. db.m3.large)
+	Product      string // type of database, with edition if any (mysql, postgresql, oracle-ee)
+	LicenseModel string // li or byol for engines having both, empty otherwise
+	MultiAZ      bool   // instance spans multiple availability zones
 }
 
 type state uint8
@@ -282,16 +1988,32 @@ type state uint8
 const (
 	UnknownState = iota
 	Active
+	Pending // reservation is paid for or queued, but not active yet
 )
 
 func (s state) String() string {
 	switch s {
 	case Active:
 		return "active"
+	case Pending:
+		return "pending"
 	}
 	return "unsupported state"
 }
 
+// recentUnused returns how many of recently purchased reservations are
+// unused, given netted count v for some key; negative v means unused
+// reservations.
+func recentUnused(v, recent int) int {
+	if v >= 0 {
+		return 0
+	}
+	if -v < recent {
+		return -v
+	}
+	return recent
+}
+
 // toInt unpacks aws.IntegerValue to integer; nil value corresponds to 0.
 func toInt(i aws.IntegerValue) int {
 	if i == nil {
@@ -300,6 +2022,22 @@ func toInt(i aws.IntegerValue) int {
 	return *i
 }
 
+// toLong unpacks aws.LongValue to int64; nil value corresponds to 0.
+func toLong(i aws.LongValue) int64 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// toDouble unpacks aws.DoubleValue to float64; nil value corresponds to 0.
+func toDouble(f aws.DoubleValue) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
+
 // toStr unpacks aws.StringValue to string; nil value corresponds to empty
 // string.
 func toStr(s aws.StringValue) string {
@@ -317,6 +2055,40 @@ func toBool(b aws.BooleanValue) bool {
 	return *b
 }
 
+// rdsFamily returns name of service instances and reservations of RDS
+// product are reported under
+func rdsFamily(product string) string {
+	switch product {
+	case "docdb":
+		return "DocumentDB"
+	case "neptune":
+		return "Neptune"
+	}
+	return "RDS"
+}
+
+// rdsStorageSummary describes storage of RDS instances, grouping instances
+// having the same storage, i.e. "2x gp2 100GB, 1x io1 500GB 3000 IOPS"
+func rdsStorageSummary(list []rdsInstInfo) string {
+	counts := make(map[string]int)
+	for _, ii := range list {
+		if ii.Storage == 0 {
+			continue
+		}
+		s := fmt.Sprintf("%s %dGB", ii.StorageType, ii.Storage)
+		if ii.IOPS > 0 {
+			s += fmt.Sprintf(" %d IOPS", ii.IOPS)
+		}
+		counts[strings.TrimSpace(s)] += ii.Count
+	}
+	var out []string
+	for s, n := range counts {
+		out = append(out, fmt.Sprintf("%dx %s", n, s))
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
+
 func stringMultiAZ(b bool) string {
 	if !b {
 		return ""
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+var (
+	capacityfmt = "%20s\t%15s\t%12s\t%10s\t%d\n"
+	fleetfmt    = "%30s\t%10s\t%6d target\t%6d unused\n"
+)
+
+// capacityReservation is an item of DescribeCapacityReservations response
+type capacityReservation struct {
+	ID        string    `xml:"capacityReservationId"`
+	Class     string    `xml:"instanceType"`
+	Platform  string    `xml:"instancePlatform"`
+	Zone      string    `xml:"availabilityZone"`
+	Tenancy   string    `xml:"tenancy"`
+	Total     int       `xml:"totalInstanceCount"`
+	Available int       `xml:"availableInstanceCount"`
+	State     string    `xml:"state"`
+	End       time.Time `xml:"endDate"`
+	FleetID   string    `xml:"capacityReservationFleetId"`
+}
+
+// capacityFleet is an item of DescribeCapacityReservationFleets response
+type capacityFleet struct {
+	ID     string `xml:"capacityReservationFleetId"`
+	State  string `xml:"state"`
+	Target int    `xml:"totalTargetCapacity"`
+}
+
+// getCapacityReservations returns On-Demand Capacity Reservations. Vendored
+// ec2 package predates them, so requests are made with the underlying ec2
+// client directly.
+func getCapacityReservations(creds aws.CredentialsProvider, region string, client *http.Client) ([]capacityReservation, error) {
+	c := newEC2Client(creds, region, client)
+	var out []capacityReservation
+	req := &describePage{MaxResults: aws.Integer(1000)}
+	for {
+		var resp struct {
+			Reservations []capacityReservation `xml:"capacityReservationSet>item"`
+			NextToken    string                `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeCapacityReservations", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Reservations...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+// getCapacityFleets returns Capacity Reservation Fleets
+func getCapacityFleets(creds aws.CredentialsProvider, region string, client *http.Client) ([]capacityFleet, error) {
+	c := newEC2Client(creds, region, client)
+	var out []capacityFleet
+	req := &describePage{MaxResults: aws.Integer(100)}
+	for {
+		var resp struct {
+			Fleets    []capacityFleet `xml:"capacityReservationFleetSet>item"`
+			NextToken string          `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeCapacityReservationFleets", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Fleets...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+// capacityKey describes instances capacity reservation applies to
+type capacityKey struct {
+	Class    string // instance class (i.e. m5.large)
+	Zone     string // availability zone
+	Platform string // platform as named by capacity reservations
+	Tenancy  string // default or dedicated
+}
+
+// ec2iiTock returns capacity reservation key for instance group
+func ec2iiTock(ii ec2InstInfo) capacityKey {
+	return capacityKey{
+		Class:    ii.Class,
+		Zone:     ii.Zone,
+		Platform: stringPlatform(ii.Platform),
+		Tenancy:  stringTenancy(ii.Tenancy),
+	}
+}
+
+// printCapacity prints instances running outside of capacity reservations and
+// capacity reservation slots no instance uses. Capacity reservations report
+// how many of their slots are taken, so only instances beyond that are
+// counted as not covered. Capacity reservations ending by forecast date are
+// ignored.
+//
+// Fleets spread their target capacity over member reservations of different
+// types, so unused slots of fleet members are reported per fleet instead.
+func printCapacity(ec2Used func(ec2InstInfo) bool, runningEi []ec2InstInfo,
+	reservations []capacityReservation, fleets []capacityFleet, forecast time.Time) {
+	uncovered := make(map[capacityKey]int)
+	unused := make(map[capacityKey]int)
+	unusedByFleet := make(map[string]int)
+	for _, ii := range runningEi {
+		if !ec2Used(ii) {
+			continue
+		}
+		uncovered[ec2iiTock(ii)] += ii.Count
+	}
+	for _, r := range reservations {
+		if r.State != "active" || expiresBy(r.End, forecast) {
+			continue
+		}
+		k := capacityKey{
+			Class:    r.Class,
+			Zone:     r.Zone,
+			Platform: r.Platform,
+			Tenancy:  r.Tenancy,
+		}
+		uncovered[k] -= r.Total - r.Available
+		if r.FleetID != "" {
+			unusedByFleet[r.FleetID] += r.Available
+			continue
+		}
+		unused[k] += r.Available
+	}
+
+	headerPrinted := false
+	for k, v := range uncovered {
+		if v < 1 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nEC2 instances without capacity reservations:")
+		}
+		fmt.Printf(capacityfmt, k.Class, k.Zone, k.Platform, k.Tenancy, v)
+	}
+	headerPrinted = false
+	for k, v := range unused {
+		if v < 1 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused capacity reservation slots:")
+		}
+		fmt.Printf(capacityfmt, k.Class, k.Zone, k.Platform, k.Tenancy, v)
+	}
+	headerPrinted = false
+	for _, f := range fleets {
+		v := unusedByFleet[f.ID]
+		if v < 1 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nUnused capacity reservation fleet slots:")
+		}
+		fmt.Printf(fleetfmt, f.ID, f.State, f.Target, v)
+	}
+}
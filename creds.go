@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+// detectCreds works like aws.DetectCreds, but checks that each provider can
+// actually deliver credentials before settling on it, and also supports IAM
+// Identity Center (SSO) profiles. If no provider works, returned error lists
+// every provider tried along with the reason it failed.
+func detectCreds(accessKey, secretKey string) (aws.CredentialsProvider, error) {
+	var errs credsError
+	// definite is set if a provider is configured, but fails; instance
+	// role is not tried then, as its lookups are slow outside of EC2 and
+	// failure of provider configured is what needs fixing
+	definite := false
+	switch {
+	case accessKey != "" && secretKey != "":
+		return aws.Creds(accessKey, secretKey, ""), nil
+	case accessKey != "" || secretKey != "":
+		errs = append(errs, credsAttempt{"command line flags",
+			errors.New("both -accesskey and -secretkey must be set")})
+		definite = true
+	default:
+		errs = append(errs, credsAttempt{"command line flags",
+			errors.New("-accesskey and -secretkey not set")})
+	}
+	p, err := aws.EnvCreds()
+	if err == nil {
+		return p, nil
+	}
+	errs = append(errs, credsAttempt{"environment", err})
+	definite = definite || err == aws.ErrSecretAccessKeyNotFound
+	profile := os.Getenv("AWS_PROFILE")
+	if p, err := aws.ProfileCreds("", profile, 10*time.Minute); err != nil {
+		errs = append(errs, credsAttempt{"shared credentials file", err})
+	} else if _, err := p.Credentials(); err != nil {
+		errs = append(errs, credsAttempt{"shared credentials file", err})
+	} else {
+		return p, nil
+	}
+	switch sso, err := newSSOCreds(profile); {
+	case err == errNoSSO || os.IsNotExist(err):
+		errs = append(errs, credsAttempt{"SSO profile", err})
+	case err != nil:
+		errs = append(errs, credsAttempt{"SSO profile", err})
+		definite = true
+	default:
+		if _, err := sso.Credentials(); err != nil {
+			errs = append(errs, credsAttempt{"SSO profile", err})
+			definite = true
+		} else {
+			return sso, nil
+		}
+	}
+	// profile explicitly chosen is never one of instance role
+	if definite || profile != "" {
+		errs = append(errs, credsAttempt{"EC2 instance role",
+			errors.New("not tried, as credentials configured above failed")})
+		return nil, errs
+	}
+	p = aws.IAMCreds()
+	for i := 0; i < iamAttempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		if err = probeCreds(p, iamTimeout); err == nil {
+			return p, nil
+		}
+	}
+	errs = append(errs, credsAttempt{"EC2 instance role", err})
+	return nil, errs
+}
+
+const (
+	iamAttempts = 2               // number of attempts to get instance role credentials
+	iamTimeout  = 1 * time.Second // timeout of a single attempt
+)
+
+// probeCreds calls p.Credentials and returns its error, or times out after d;
+// this is needed as instance metadata lookups can hang outside of EC2.
+func probeCreds(p aws.CredentialsProvider, d time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.Credentials()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(d):
+		return errors.New("instance metadata service did not respond in " + d.String())
+	}
+}
+
+// credsAttempt describes failed attempt to get credentials from a single
+// provider
+type credsAttempt struct {
+	Provider string
+	Err      error
+}
+
+// credsError is returned by detectCreds when none of the providers could
+// deliver credentials
+type credsError []credsAttempt
+
+func (e credsError) Error() string {
+	var b strings.Builder
+	b.WriteString("no AWS credentials found, tried:")
+	for _, a := range e {
+		fmt.Fprintf(&b, "\n  %s: %v", a.Provider, a.Err)
+	}
+	return b.String()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var eksfargatefmt = "%30s\t%6d pods\t%8.2f vCPU\t%8.2f GB\n"
+
+// fargateProfileLabel is set by EKS on pods it schedules on Fargate
+const fargateProfileLabel = "eks.amazonaws.com/fargate-profile"
+
+// getEKSFargateUsage sums up resources provisioned for Fargate pods running
+// in EKS clusters in region. EKS API does not tell about pods, so they're
+// listed with Kubernetes API of clusters having Fargate profiles, which
+// needs credentials to be mapped to Kubernetes user allowed to list pods.
+// Vendored aws-go has no EKS client, so requests are made with the
+// underlying REST client directly.
+func getEKSFargateUsage(creds aws.CredentialsProvider, region string, client *http.Client) (fargateUsage, error) {
+	c := newEKSClient(creds, region, client)
+	var out fargateUsage
+	clusters, err := eksList(c, "/clusters", "clusters")
+	if err != nil {
+		return out, err
+	}
+	for _, name := range clusters {
+		profiles, err := eksList(c, "/clusters/"+name+"/fargate-profiles", "fargateProfileNames")
+		if err != nil {
+			return out, err
+		}
+		if len(profiles) == 0 {
+			continue
+		}
+		var resp struct {
+			Cluster struct {
+				Endpoint             string `json:"endpoint"`
+				CertificateAuthority struct {
+					Data string `json:"data"`
+				} `json:"certificateAuthority"`
+			} `json:"cluster"`
+		}
+		if err := searchDo(c, "GET", "/clusters/"+name, nil, nil, &resp); err != nil {
+			return out, err
+		}
+		u, err := getFargatePods(creds, region, name, resp.Cluster.Endpoint, resp.Cluster.CertificateAuthority.Data)
+		if err != nil && !isAccessDenied(err) {
+			err = fmt.Errorf("EKS cluster %s: %v", name, err)
+		}
+		if err != nil {
+			return out, err
+		}
+		out.Tasks += u.Tasks
+		out.VCPU += u.VCPU
+		out.Memory += u.Memory
+	}
+	return out, nil
+}
+
+func newEKSClient(creds aws.CredentialsProvider, region string, client *http.Client) *aws.RestClient {
+	endpoint, service, region := endpoints.Lookup("eks", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.RestClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:   client,
+		Endpoint: endpoint,
+	}
+}
+
+// eksList calls paginated EKS List* operation at path and returns all values
+// of field of its responses
+func eksList(c *aws.RestClient, path, field string) ([]string, error) {
+	var out []string
+	q := url.Values{"maxResults": {"100"}}
+	for {
+		var resp map[string]interface{}
+		if err := searchDo(c, "GET", path, q, nil, &resp); err != nil {
+			return nil, err
+		}
+		values, _ := resp[field].([]interface{})
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		next, _ := resp["nextToken"].(string)
+		if next == "" {
+			return out, nil
+		}
+		q.Set("nextToken", next)
+	}
+}
+
+// getFargatePods sums up resources provisioned for running Fargate pods of
+// EKS cluster, as reported by CapacityProvisioned annotation Fargate sets
+// (i.e. "0.25vCPU 0.5GB"). Cluster API server is at endpoint, its
+// certificate authority is caData in base64.
+func getFargatePods(creds aws.CredentialsProvider, region, cluster, endpoint, caData string) (fargateUsage, error) {
+	var out fargateUsage
+	ca, err := base64.StdEncoding.DecodeString(caData)
+	if err != nil {
+		return out, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return out, fmt.Errorf("cannot parse certificate authority")
+	}
+	token, err := eksToken(creds, region, cluster)
+	if err != nil {
+		return out, err
+	}
+	client := &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+	q := url.Values{
+		"labelSelector": {fargateProfileLabel},
+		"fieldSelector": {"status.phase=Running"},
+		"limit":         {"500"},
+	}
+	for {
+		req, err := http.NewRequest("GET", endpoint+"/api/v1/pods?"+q.Encode(), nil)
+		if err != nil {
+			return out, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			return out, err
+		}
+		var list struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []struct {
+				Metadata struct {
+					Annotations map[string]string `json:"annotations"`
+				} `json:"metadata"`
+			} `json:"items"`
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(&list)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			// credentials are not mapped to Kubernetes user allowed
+			// to list pods, which is missing permissions as well
+			err = aws.APIError{StatusCode: http.StatusForbidden, Message: resp.Status}
+		default:
+			err = fmt.Errorf("listing pods: %s", resp.Status)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return out, err
+		}
+		for _, p := range list.Items {
+			cpu, mem, ok := parseCapacityProvisioned(p.Metadata.Annotations["CapacityProvisioned"])
+			if !ok {
+				continue
+			}
+			out.Tasks++
+			out.VCPU += cpu
+			out.Memory += mem
+		}
+		if list.Metadata.Continue == "" {
+			return out, nil
+		}
+		q.Set("continue", list.Metadata.Continue)
+	}
+}
+
+// parseCapacityProvisioned parses CapacityProvisioned annotation of Fargate
+// pod, i.e. "0.25vCPU 0.5GB", into vCPUs and GB of memory
+func parseCapacityProvisioned(s string) (cpu, mem float64, ok bool) {
+	f := strings.Fields(s)
+	if len(f) != 2 || !strings.HasSuffix(f[0], "vCPU") || !strings.HasSuffix(f[1], "GB") {
+		return 0, 0, false
+	}
+	var err1, err2 error
+	cpu, err1 = strconv.ParseFloat(strings.TrimSuffix(f[0], "vCPU"), 64)
+	mem, err2 = strconv.ParseFloat(strings.TrimSuffix(f[1], "GB"), 64)
+	return cpu, mem, err1 == nil && err2 == nil
+}
+
+// eksToken returns bearer token EKS clusters accept for authentication: STS
+// GetCallerIdentity request presigned for cluster name, which cluster makes
+// on its own to find out caller identity.
+func eksToken(creds aws.CredentialsProvider, region, cluster string) (string, error) {
+	c, err := creds.Credentials()
+	if err != nil {
+		return "", err
+	}
+	endpoint, service, region := endpoints.Lookup("sts", region)
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	scope := now.Format("20060102") + "/" + region + "/" + service + "/aws4_request"
+	q := url.Values{
+		"Action":              {"GetCallerIdentity"},
+		"Version":             {"2011-06-15"},
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {c.AccessKeyID + "/" + scope},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {"60"},
+		"X-Amz-SignedHeaders": {"host;x-k8s-aws-id"},
+	}
+	if c.SecurityToken != "" {
+		q.Set("X-Amz-Security-Token", c.SecurityToken)
+	}
+	emptyHash := sha256.Sum256(nil)
+	req := "GET\n/\n" + q.Encode() + "\n" +
+		"host:" + u.Host + "\n" + "x-k8s-aws-id:" + cluster + "\n\n" +
+		"host;x-k8s-aws-id\n" + hex.EncodeToString(emptyHash[:])
+	reqHash := sha256.Sum256([]byte(req))
+	toSign := "AWS4-HMAC-SHA256\n" + q.Get("X-Amz-Date") + "\n" +
+		scope + "\n" + hex.EncodeToString(reqHash[:])
+	signingKey := []byte("AWS4" + c.SecretAccessKey)
+	for _, s := range strings.Split(scope, "/") {
+		signingKey = hmacSHA256(signingKey, s)
+	}
+	q.Set("X-Amz-Signature", hex.EncodeToString(hmacSHA256(signingKey, toSign)))
+	u.Path = "/"
+	u.RawQuery = q.Encode()
+	return "k8s-aws-v1." + base64.RawURLEncoding.EncodeToString([]byte(u.String())), nil
+}
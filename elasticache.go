@@ -0,0 +1,221 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	elasticcache "github.com/stripe/aws-go/gen/elasticache"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var (
+	cachefmt           = "%20s\t%10s\t%d\n"
+	serverlesscachefmt = "%30s\t%10s\t%s\n"
+)
+
+// getElastiCacheNodes returns both running and reserved ElastiCache nodes, so
+// that either both or none are available for matching.
+func getElastiCacheNodes(creds aws.CredentialsProvider, region string, client *http.Client) (running, reserved []cacheNodeInfo, err error) {
+	if running, err = getRunningElastiCacheNodes(creds, region, client); err != nil {
+		return nil, nil, err
+	}
+	if reserved, err = getReservedElastiCacheNodes(creds, region, client); err != nil {
+		return nil, nil, err
+	}
+	return running, reserved, nil
+}
+
+func getRunningElastiCacheNodes(creds aws.CredentialsProvider, region string, client *http.Client) ([]cacheNodeInfo, error) {
+	ecc := elasticcache.New(creds, region, client)
+	var clusters []elasticcache.CacheCluster
+	req := &elasticcache.DescribeCacheClustersMessage{MaxRecords: aws.Integer(100)}
+	for {
+		resp, err := ecc.DescribeCacheClusters(req)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, resp.CacheClusters...)
+		if toStr(resp.Marker) == "" {
+			break
+		}
+		req.Marker = resp.Marker
+	}
+	var groups []elasticcache.ReplicationGroup
+	rgReq := &elasticcache.DescribeReplicationGroupsMessage{MaxRecords: aws.Integer(100)}
+	for {
+		resp, err := ecc.DescribeReplicationGroups(rgReq)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, resp.ReplicationGroups...)
+		if toStr(resp.Marker) == "" {
+			break
+		}
+		rgReq.Marker = resp.Marker
+	}
+	var out []cacheNodeInfo
+	for _, c := range clusters {
+		out = append(out, eccToecni(c))
+	}
+	return append(out, missingGroupNodes(groups, clusters)...), nil
+}
+
+// serverlessCache is an item of DescribeServerlessCaches response
+type serverlessCache struct {
+	Name   string `xml:"ServerlessCacheName"`
+	Engine string `xml:"Engine"`
+	Status string `xml:"Status"`
+}
+
+// getServerlessCaches returns ElastiCache Serverless caches, which are billed
+// by usage and can't be covered by reserved nodes. Vendored elasticache
+// package predates them, so requests are made with the underlying query
+// client directly.
+func getServerlessCaches(creds aws.CredentialsProvider, region string, client *http.Client) ([]serverlessCache, error) {
+	endpoint, service, region := endpoints.Lookup("elasticache", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	qc := &aws.QueryClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:     client,
+		Endpoint:   endpoint,
+		APIVersion: "2015-02-02",
+	}
+	req := &struct {
+		NextToken aws.StringValue `query:"NextToken"`
+	}{}
+	var out []serverlessCache
+	for {
+		var resp struct {
+			Caches    []serverlessCache `xml:"DescribeServerlessCachesResult>ServerlessCaches>member"`
+			NextToken string            `xml:"DescribeServerlessCachesResult>NextToken"`
+		}
+		if err := qc.Do("DescribeServerlessCaches", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Caches...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+// missingGroupNodes returns nodes of replication groups which have no cache
+// cluster listed. Every node of a replication group, a primary or a replica
+// of any shard, is a member cache cluster of its own, so normally there are
+// none; but member clusters being created or replaced may be listed in group
+// before they show up as cache clusters. Missing nodes are taken to be of the
+// same type as their listed siblings.
+func missingGroupNodes(groups []elasticcache.ReplicationGroup, clusters []elasticcache.CacheCluster) []cacheNodeInfo {
+	listed := make(map[string]elasticcache.CacheCluster)
+	for _, c := range clusters {
+		listed[toStr(c.CacheClusterID)] = c
+	}
+	var out []cacheNodeInfo
+	for _, g := range groups {
+		var sibling *elasticcache.CacheCluster
+		missing := 0
+		for _, id := range g.MemberClusters {
+			if c, ok := listed[id]; ok {
+				sibling = &c
+				continue
+			}
+			missing++
+		}
+		if missing == 0 || sibling == nil {
+			continue
+		}
+		ni := eccToecni(*sibling)
+		ni.Count = missing
+		ni.Status = toStr(g.Status)
+		ni.State = UnknownState
+		switch ni.Status {
+		case "available", "creating", "modifying", "snapshotting":
+			ni.State = Active
+		}
+		out = append(out, ni)
+	}
+	return out
+}
+
+func getReservedElastiCacheNodes(creds aws.CredentialsProvider, region string, client *http.Client) ([]cacheNodeInfo, error) {
+	ecc := elasticcache.New(creds, region, client)
+	req := &elasticcache.DescribeReservedCacheNodesMessage{MaxRecords: aws.Integer(100)}
+	var out []cacheNodeInfo
+	for {
+		resp, err := ecc.DescribeReservedCacheNodes(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.ReservedCacheNodes {
+			out = append(out, ecrnToecni(r))
+		}
+		if toStr(resp.Marker) == "" {
+			return out, nil
+		}
+		req.Marker = resp.Marker
+	}
+}
+
+// eccToecni converts elasticcache.CacheCluster to cacheNodeInfo. State is set
+// to Active for clusters that are being created, available or modified.
+func eccToecni(c elasticcache.CacheCluster) cacheNodeInfo {
+	out := cacheNodeInfo{
+		cacheNode: cacheNode{
+			Class:   toStr(c.CacheNodeType),
+			Product: toStr(c.Engine),
+		},
+		Count:  toInt(c.NumCacheNodes),
+		Status: toStr(c.CacheClusterStatus),
+	}
+	switch out.Status {
+	case "available", "creating", "modifying", "snapshotting",
+		"rebooting cache cluster nodes":
+		out.State = Active
+	}
+	return out
+}
+
+// ecrnToecni converts elasticcache.ReservedCacheNode to cacheNodeInfo
+func ecrnToecni(r elasticcache.ReservedCacheNode) cacheNodeInfo {
+	out := cacheNodeInfo{
+		cacheNode: cacheNode{
+			Class:   toStr(r.CacheNodeType),
+			Product: toStr(r.ProductDescription),
+		},
+		Count:  toInt(r.CacheNodeCount),
+		Status: toStr(r.State),
+		Start:  r.StartTime,
+		End:    r.StartTime.Add(time.Duration(toInt(r.Duration)) * time.Second),
+	}
+	switch out.Status {
+	case "active":
+		out.State = Active
+	case "payment-pending":
+		out.State = Pending
+	}
+	return out
+}
+
+// cacheNodeInfo describes a group of ElastiCache nodes having the same state
+type cacheNodeInfo struct {
+	cacheNode
+	Count  int       // number of nodes in group
+	State  state     // state of nodes in group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for nodes
+	End    time.Time // reservation end time, zero for nodes
+}
+
+// cacheNode describes single ElastiCache node
+type cacheNode struct {
+	Class   string // node type (i.e. cache.m3.large)
+	Product string // cache engine (redis, memcached)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+// endpointConfig describes how to override endpoints from the vendored aws-go
+// endpoint table
+type endpointConfig struct {
+	Hosts     map[string]string // explicit endpoint hosts by service name
+	Private   bool              // use regional endpoints only
+	FIPS      bool              // use FIPS 140-2 validated endpoints
+	DualStack bool              // use dual-stack (IPv4 and IPv6) endpoints
+}
+
+// fipsRegions lists regions having FIPS endpoints by service; only services
+// this tool talks to are listed. Services are named as in signatures (i.e.
+// monitoring for CloudWatch).
+var fipsRegions = map[string][]string{
+	"autoscaling":         {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+	"ec2":                 {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "us-gov-east-1", "us-gov-west-1"},
+	"ecs":                 {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+	"eks":                 {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+	"elasticache":         {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-west-1"},
+	"es":                  {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+	"lambda":              {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-west-1"},
+	"medialive":           {"us-east-1", "us-east-2", "us-west-2"},
+	"memorydb":            {"us-west-1"},
+	"license-manager":     {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+	"monitoring":          {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+	"rds":                 {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "us-gov-east-1", "us-gov-west-1"},
+	"redshift":            {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "us-gov-east-1", "us-gov-west-1"},
+	"redshift-serverless": {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1"},
+	"s3":                  {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "us-gov-east-1", "us-gov-west-1"},
+	"sts":                 {"us-east-1", "us-east-2", "us-west-1", "us-west-2", "us-gov-east-1", "us-gov-west-1"},
+}
+
+// endpointNames lists endpoint host prefixes of services which differ from
+// their names in signatures
+var endpointNames = map[string]string{
+	"memorydb":  "memory-db",
+	"sagemaker": "api.sagemaker",
+}
+
+// dualStackNames lists endpoint host prefixes of services having dual-stack
+// endpoints; most of them are in api.aws domain, while S3 ones are in
+// amazonaws.com domain with dualstack label after service name.
+var dualStackNames = map[string]string{
+	"autoscaling": "autoscaling",
+	"ec2":         "ec2",
+	"ecs":         "ecs",
+	"eks":         "eks",
+	"elasticache": "elasticache",
+	"es":          "aos",
+	"lambda":      "lambda",
+	"monitoring":  "monitoring",
+	"rds":         "rds",
+	"redshift":    "redshift",
+	"s3":          "s3",
+	"sts":         "sts",
+}
+
+// parseServiceMap parses comma separated list of service=value pairs, value
+// names the kind of value for error messages
+func parseServiceMap(s, value string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		i := strings.IndexByte(f, '=')
+		if i < 1 || i == len(f)-1 {
+			return nil, fmt.Errorf("invalid %s %q, want service=%s", value, f, value)
+		}
+		out[f[:i]] = f[i+1:]
+	}
+	return out, nil
+}
+
+// host returns endpoint host for service in region, empty host means that
+// default endpoint should be used.
+func (c endpointConfig) host(service, region string) (string, error) {
+	if h, ok := c.Hosts[service]; ok {
+		return h, nil
+	}
+	if !c.Private && !c.FIPS && !c.DualStack {
+		return "", nil
+	}
+	// VPC interface endpoints with private DNS only take over regional
+	// names, while aws-go uses global ones for some services (sts, rds in
+	// us-east-1), so all modes use regional names
+	name := service
+	if n, ok := endpointNames[service]; ok {
+		name = n
+	}
+	if c.DualStack {
+		n, ok := dualStackNames[service]
+		if !ok {
+			return "", fmt.Errorf("%s has no dual-stack endpoint, set one with -endpoints", service)
+		}
+		name = n
+	}
+	if c.FIPS {
+		if !hasFIPS(service, region) {
+			return "", fmt.Errorf("%s has no FIPS endpoint in %s", service, region)
+		}
+		name += "-fips"
+	}
+	switch cn := strings.HasPrefix(region, "cn-"); {
+	case c.DualStack && service == "s3" && cn:
+		return name + ".dualstack." + region + ".amazonaws.com.cn", nil
+	case c.DualStack && service == "s3":
+		return name + ".dualstack." + region + ".amazonaws.com", nil
+	case c.DualStack && cn:
+		return name + "." + region + ".api.amazonwebservices.com.cn", nil
+	case c.DualStack:
+		return name + "." + region + ".api.aws", nil
+	case cn:
+		return name + "." + region + ".amazonaws.com.cn", nil
+	}
+	return name + "." + region + ".amazonaws.com", nil
+}
+
+// hasFIPS reports whether service has FIPS endpoint in region
+func hasFIPS(service, region string) bool {
+	for _, r := range fipsRegions[service] {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPClient returns http client that sends requests to endpoints chosen
+// by cfg, re-signing them with whichever of creds signed them originally. It
+// returns nil if cfg has nothing to override, so that aws-go uses its default
+// client.
+func newHTTPClient(cfg endpointConfig, creds ...aws.CredentialsProvider) *http.Client {
+	if len(cfg.Hosts) == 0 && !cfg.Private && !cfg.FIPS && !cfg.DualStack {
+		return nil
+	}
+	return &http.Client{Transport: &endpointTransport{
+		creds: creds,
+		cfg:   cfg,
+		next:  http.DefaultTransport,
+	}}
+}
+
+// endpointTransport redirects requests signed by aws-go to another endpoint.
+// As endpoint host is part of the signature, requests are signed again after
+// host is changed.
+type endpointTransport struct {
+	creds []aws.CredentialsProvider
+	cfg   endpointConfig
+	next  http.RoundTripper
+
+	mu    sync.Mutex
+	byKey map[string]aws.CredentialsProvider // providers by access key id they signed with
+}
+
+func (t *endpointTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	scope, err := credentialScope(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	// scope is date/region/service/aws4_request
+	parts := strings.Split(scope, "/")
+	host, err := t.cfg.host(parts[2], parts[1])
+	if err != nil || host == "" || host == r.URL.Host {
+		if err != nil {
+			return nil, err
+		}
+		return t.next.RoundTrip(r)
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Host = host
+	r2.Host = host
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r2.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err := t.sign(r2, credentialKey(r.Header.Get("Authorization")), scope); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(r2)
+}
+
+// sign (re)signs request with AWS signature version 4, reusing date, scope
+// and payload hash of the original signature, and credentials having key id.
+func (t *endpointTransport) sign(r *http.Request, key, scope string) error {
+	creds, err := t.credentials(key)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Host", r.Host)
+	names := []string{"host"}
+	for k := range r.Header {
+		if k = strings.ToLower(k); k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	var req bytes.Buffer
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	fmt.Fprintf(&req, "%s\n%s\n%s\n", r.Method, path, r.URL.Query().Encode())
+	for _, k := range names {
+		fmt.Fprintf(&req, "%s:%s\n", k, strings.TrimSpace(r.Header.Get(k)))
+	}
+	signed := strings.Join(names, ";")
+	fmt.Fprintf(&req, "\n%s\n%s", signed, r.Header.Get("X-Amz-Content-Sha256"))
+	r.Header.Del("Host")
+
+	reqHash := sha256.Sum256(req.Bytes())
+	toSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" +
+		scope + "\n" + hex.EncodeToString(reqHash[:])
+	signingKey := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range strings.Split(scope, "/") {
+		signingKey = hmacSHA256(signingKey, s)
+	}
+	r.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		creds.AccessKeyID, scope, signed, hmacSHA256(signingKey, toSign)))
+	return nil
+}
+
+// credentials returns credentials having access key id. Provider which
+// signed request originally is picked by key from providers seen before, so
+// that other providers are not asked for credentials they may fail to get
+// (i.e. roles of other accounts); providers not seen yet are asked in turn,
+// skipping ones failing to provide credentials.
+func (t *endpointTransport) credentials(key string) (*aws.Credentials, error) {
+	t.mu.Lock()
+	p, ok := t.byKey[key]
+	t.mu.Unlock()
+	if ok {
+		c, err := p.Credentials()
+		if err != nil {
+			return nil, err
+		}
+		if c.AccessKeyID == key {
+			return c, nil
+		}
+	}
+	var lastErr error
+	for _, p := range t.creds {
+		c, err := p.Credentials()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		t.mu.Lock()
+		if t.byKey == nil {
+			t.byKey = make(map[string]aws.CredentialsProvider)
+		}
+		t.byKey[c.AccessKeyID] = p
+		t.mu.Unlock()
+		if c.AccessKeyID == key {
+			return c, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("no credentials with access key id %q to sign request with: %v", key, lastErr)
+	}
+	return nil, fmt.Errorf("no credentials with access key id %q to sign request with", key)
+}
+
+// credentialScope extracts credential scope from signature v4 Authorization
+// header value
+func credentialScope(auth string) (string, error) {
+	const pfx = "Credential="
+	i := strings.Index(auth, pfx)
+	if i < 0 {
+		return "", fmt.Errorf("request has no signature v4 credential")
+	}
+	cred := auth[i+len(pfx):]
+	if i := strings.IndexByte(cred, ','); i >= 0 {
+		cred = cred[:i]
+	}
+	// credential is key/date/region/service/aws4_request
+	if i := strings.IndexByte(cred, '/'); i >= 0 {
+		if scope := cred[i+1:]; strings.Count(scope, "/") == 3 {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("malformed signature v4 credential %q", cred)
+}
+
+// credentialKey extracts access key id from signature v4 Authorization
+// header value
+func credentialKey(auth string) string {
+	const pfx = "Credential="
+	i := strings.Index(auth, pfx)
+	if i < 0 {
+		return ""
+	}
+	cred := auth[i+len(pfx):]
+	if i := strings.IndexByte(cred, '/'); i >= 0 {
+		return cred[:i]
+	}
+	return ""
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	io.WriteString(h, data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+// isAccessDenied reports whether err is AWS API error caused by missing
+// permissions
+func isAccessDenied(err error) bool {
+	e, ok := err.(aws.APIError)
+	if !ok {
+		return false
+	}
+	switch e.Code {
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	case "":
+		// JSON protocol errors only carry type, which may be prefixed
+		// with namespace (i.e. "com.amazon...#AccessDeniedException"),
+		// and REST JSON ones may carry neither
+		if e.Type != "" {
+			return strings.HasSuffix(e.Type, "AccessDeniedException")
+		}
+		return e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var fargatefmt = "%30s\t%6d tasks\t%8.2f vCPU\t%8.2f GB\n"
+
+// fargateUsage describes resources requested by running Fargate tasks (ECS)
+// or pods (EKS)
+type fargateUsage struct {
+	Tasks  int // number of tasks or pods
+	VCPU   float64
+	Memory float64 // GB
+}
+
+// getFargateUsage sums up resources of Fargate tasks running in ECS clusters
+// in region. Vendored aws-go has no ECS client, so requests are made with the
+// underlying JSON client directly.
+func getFargateUsage(creds aws.CredentialsProvider, region string, client *http.Client) (fargateUsage, error) {
+	c := newECSClient(creds, region, client)
+	var out fargateUsage
+	clusters, err := ecsList(c, "ListClusters", "clusterArns", map[string]string{})
+	if err != nil {
+		return out, err
+	}
+	for _, cluster := range clusters {
+		tasks, err := ecsList(c, "ListTasks", "taskArns", map[string]string{
+			"cluster":       cluster,
+			"launchType":    "FARGATE",
+			"desiredStatus": "RUNNING",
+		})
+		if err != nil {
+			return out, err
+		}
+		// DescribeTasks takes up to 100 tasks at once
+		for len(tasks) > 0 {
+			n := len(tasks)
+			if n > 100 {
+				n = 100
+			}
+			req := struct {
+				Cluster string   `json:"cluster"`
+				Tasks   []string `json:"tasks"`
+			}{cluster, tasks[:n]}
+			tasks = tasks[n:]
+			var resp struct {
+				Tasks []struct {
+					CPU    string `json:"cpu"`    // CPU units, 1024 per vCPU
+					Memory string `json:"memory"` // MiB
+				} `json:"tasks"`
+			}
+			if err := c.Do("DescribeTasks", "POST", "/", req, &resp); err != nil {
+				return out, err
+			}
+			for _, t := range resp.Tasks {
+				cpu, _ := strconv.ParseFloat(t.CPU, 64)
+				mem, _ := strconv.ParseFloat(t.Memory, 64)
+				out.Tasks++
+				out.VCPU += cpu / 1024
+				out.Memory += mem / 1024
+			}
+		}
+	}
+	return out, nil
+}
+
+func newECSClient(creds aws.CredentialsProvider, region string, client *http.Client) *aws.JSONClient {
+	endpoint, service, region := endpoints.Lookup("ecs", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.JSONClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:       client,
+		Endpoint:     endpoint,
+		TargetPrefix: "AmazonEC2ContainerServiceV20141113",
+		JSONVersion:  "1.1",
+	}
+}
+
+// ecsList calls paginated ECS List* operation op with req parameters and
+// returns all values of field of its responses.
+func ecsList(c *aws.JSONClient, op, field string, req map[string]string) ([]string, error) {
+	var out []string
+	for {
+		var resp map[string]interface{}
+		if err := c.Do(op, "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		values, _ := resp[field].([]interface{})
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		next, _ := resp["nextToken"].(string)
+		if next == "" {
+			return out, nil
+		}
+		req["nextToken"] = next
+	}
+}
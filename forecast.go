@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// plannedChange describes a planned change of EC2 fleet size
+type plannedChange struct {
+	ec2Inst
+	Date   time.Time // date change takes effect
+	Region string    // region change applies to
+	Count  int       // number of instances added (positive) or removed (negative)
+}
+
+// readPlan reads planned fleet changes from csv file. Each record has the
+// following fields: date (YYYY-MM-DD), region, instance class, signed instance
+// count and optional "vpc" marker, i.e.:
+//
+//	2024-09-01,eu-west-1,m3.large,+10,vpc
+//
+// Empty lines and lines starting with # are ignored.
+func readPlan(name string) ([]plannedChange, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rd := csv.NewReader(f)
+	rd.Comment = '#'
+	rd.FieldsPerRecord = -1
+	rd.TrimLeadingSpace = true
+	var out []plannedChange
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := rd.FieldPos(0)
+		if len(rec) < 4 || len(rec) > 5 {
+			return nil, fmt.Errorf("%s:%d: want 4 or 5 fields, got %d", name, line, len(rec))
+		}
+		c := plannedChange{
+			ec2Inst: ec2Inst{Class: rec[2]},
+			Region:  rec[1],
+		}
+		if c.Date, err = time.Parse(dateLayout, rec[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		if c.Count, err = strconv.Atoi(rec[3]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		if len(rec) == 5 {
+			switch strings.ToLower(rec[4]) {
+			case "vpc":
+				c.VPC = true
+			case "":
+			default:
+				return nil, fmt.Errorf("%s:%d: unexpected field %q", name, line, rec[4])
+			}
+		}
+		out = append(out, c)
+	}
+}
+
+// expiresBy reports whether reservation with given end time is expired by
+// date t. Zero t means no forecast, so nothing expires.
+func expiresBy(end, t time.Time) bool {
+	if t.IsZero() || end.IsZero() {
+		return false
+	}
+	return !end.After(t)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/rds"
+)
+
+var gravitonfmt = "%20s\t%10s\t%9s\t%d\t$%.0f/month\t%20s\t$%.0f/month\n"
+
+// hoursPerMonth is average number of hours in a month
+const hoursPerMonth = 730
+
+// gravitonFamilies maps Intel RDS instance families to their Graviton
+// equivalents of the same sizes
+var gravitonFamilies = map[string]string{
+	"db.m4": "db.m6g",
+	"db.m5": "db.m6g",
+	"db.r4": "db.r6g",
+	"db.r5": "db.r6g",
+	"db.t3": "db.t4g",
+}
+
+// gravitonClass returns Graviton equivalent of RDS instance class (i.e.
+// db.m6g.large for db.m5.large), or empty string if there's none
+func gravitonClass(class string) string {
+	i := strings.LastIndexByte(class, '.')
+	if i < 0 {
+		return ""
+	}
+	family, ok := gravitonFamilies[class[:i]]
+	if !ok {
+		return ""
+	}
+	return family + class[i:]
+}
+
+// getRDSReservationPrice returns effective hourly price of 1 year No Upfront
+// reservation for RDS instance, USD; ok is false if no such reservation is
+// offered (i.e. engine does not support class).
+func getRDSReservationPrice(creds aws.CredentialsProvider, region string, client *http.Client, k rdsInst) (price float64, ok bool, err error) {
+	resp, err := rds.New(creds, region, client).DescribeReservedDBInstancesOfferings(&rds.DescribeReservedDBInstancesOfferingsMessage{
+		DBInstanceClass:    aws.String(k.Class),
+		ProductDescription: aws.String(rdsDescription(k)),
+		MultiAZ:            aws.Boolean(k.MultiAZ),
+		Duration:           aws.String("1"),
+		OfferingType:       aws.String("No Upfront"),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	for _, o := range resp.ReservedDBInstancesOfferings {
+		if toStr(o.ProductDescription) != rdsDescription(k) {
+			continue
+		}
+		hours := float64(toInt(o.Duration)) / 3600
+		price = toDouble(o.UsagePrice)
+		if hours > 0 {
+			price += toDouble(o.FixedPrice) / hours
+		}
+		for _, c := range o.RecurringCharges {
+			if toStr(c.RecurringChargeFrequency) == "Hourly" {
+				price += toDouble(c.RecurringChargeAmount)
+			}
+		}
+		return price, true, nil
+	}
+	return 0, false, nil
+}
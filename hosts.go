@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var (
+	hostfmt    = "%20s\t%15s\t%d\n"
+	machostfmt = "%20s\t%15s\treleasable after %s\n"
+)
+
+// macMinAllocation is how long Mac Dedicated Hosts are billed for at least
+// once allocated; they can't be released earlier.
+const macMinAllocation = 24 * time.Hour
+
+// getDedicatedHosts returns both allocated Dedicated Hosts and host
+// reservations, so that either both or none are available for matching.
+// Vendored ec2 package predates Dedicated Hosts, so requests are made with
+// the underlying ec2 client directly.
+func getDedicatedHosts(creds aws.CredentialsProvider, region string, client *http.Client) (running, reserved []hostInfo, err error) {
+	ec2c := newEC2Client(creds, region, client)
+	hosts, err := describeHosts(ec2c)
+	if err != nil {
+		return nil, nil, err
+	}
+	reservations, err := describeHostReservations(ec2c)
+	if err != nil {
+		return nil, nil, err
+	}
+	zones := make(map[string]string)
+	for _, h := range hosts {
+		zones[h.HostID] = h.Zone
+		running = append(running, dhTohi(h))
+	}
+	for _, r := range reservations {
+		reserved = append(reserved, hrTohi(r, zones)...)
+	}
+	return running, reserved, nil
+}
+
+// newEC2Client returns low level ec2 client for calls vendored ec2 package
+// lacks
+func newEC2Client(creds aws.CredentialsProvider, region string, client *http.Client) *aws.EC2Client {
+	endpoint, service, region := endpoints.Lookup("ec2", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.EC2Client{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:     client,
+		Endpoint:   endpoint,
+		APIVersion: "2016-11-15",
+	}
+}
+
+// dedicatedHost is an item of DescribeHosts response
+type dedicatedHost struct {
+	HostID        string    `xml:"hostId"`
+	Zone          string    `xml:"availabilityZone"`
+	State         string    `xml:"state"`
+	ReservationID string    `xml:"hostReservationId"`
+	Family        string    `xml:"hostProperties>instanceFamily"`
+	InstanceType  string    `xml:"hostProperties>instanceType"`
+	Allocated     time.Time `xml:"allocationTime"`
+}
+
+// hostReservation is an item of DescribeHostReservations response
+type hostReservation struct {
+	ID      string    `xml:"hostReservationId"`
+	HostIDs []string  `xml:"hostIdSet>item"`
+	Family  string    `xml:"instanceFamily"`
+	State   string    `xml:"state"`
+	Count   int       `xml:"count"`
+	Start   time.Time `xml:"start"`
+	End     time.Time `xml:"end"`
+}
+
+// describePage is request for a single page of paginated ec2 Describe* calls
+type describePage struct {
+	MaxResults aws.IntegerValue `ec2:"MaxResults"`
+	NextToken  aws.StringValue  `ec2:"NextToken"`
+}
+
+func describeHosts(c *aws.EC2Client) ([]dedicatedHost, error) {
+	var out []dedicatedHost
+	req := &describePage{MaxResults: aws.Integer(500)}
+	for {
+		var resp struct {
+			Hosts     []dedicatedHost `xml:"hostSet>item"`
+			NextToken string          `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeHosts", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Hosts...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+func describeHostReservations(c *aws.EC2Client) ([]hostReservation, error) {
+	var out []hostReservation
+	req := &describePage{MaxResults: aws.Integer(500)}
+	for {
+		var resp struct {
+			Reservations []hostReservation `xml:"hostReservationSet>item"`
+			NextToken    string            `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeHostReservations", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Reservations...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+// dhTohi converts dedicatedHost to hostInfo. State is set to Active for
+// allocated hosts, which are billed regardless of instances placed on them.
+func dhTohi(h dedicatedHost) hostInfo {
+	out := hostInfo{
+		hostGroup: hostGroup{
+			Family: h.Family,
+			Zone:   h.Zone,
+		},
+		Count:     1,
+		Status:    h.State,
+		Allocated: h.Allocated,
+	}
+	// hosts allocated for a single instance type may only report type
+	if out.Family == "" {
+		out.Family = instanceFamily(h.InstanceType)
+	}
+	switch out.Status {
+	case "available", "under-assessment", "pending":
+		out.State = Active
+	}
+	return out
+}
+
+// hrTohi converts hostReservation to hostInfo, one per host reservation
+// covers. Host reservations have no zone of their own, so it's taken from
+// hosts by their ids; zones maps host id to its zone.
+func hrTohi(r hostReservation, zones map[string]string) []hostInfo {
+	tmpl := hostInfo{
+		hostGroup: hostGroup{Family: r.Family},
+		Count:     r.Count,
+		Status:    r.State,
+		Start:     r.Start,
+		End:       r.End,
+	}
+	switch tmpl.Status {
+	case "active":
+		tmpl.State = Active
+	case "payment-pending":
+		tmpl.State = Pending
+	}
+	if len(r.HostIDs) == 0 {
+		return []hostInfo{tmpl}
+	}
+	out := make([]hostInfo, 0, len(r.HostIDs))
+	for _, id := range r.HostIDs {
+		hi := tmpl
+		hi.Zone = zones[id]
+		hi.Count = 1
+		out = append(out, hi)
+	}
+	return out
+}
+
+// hostInfo describes a group of Dedicated Hosts having the same state
+type hostInfo struct {
+	hostGroup
+	Count  int       // number of hosts in group
+	State  state     // state of hosts in group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for hosts
+	End    time.Time // reservation end time, zero for hosts
+
+	Allocated time.Time // host allocation time, zero for reservations
+}
+
+// isMac reports whether hosts of the group run Mac instances
+func (g hostGroup) isMac() bool {
+	return strings.HasPrefix(g.Family, "mac")
+}
+
+// hostGroup describes Dedicated Hosts reservations apply to
+type hostGroup struct {
+	Family string // instance family (i.e. m4)
+	Zone   string // availability zone, empty if unknown
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+// callerIdentity describes the account and principal credentials belong to
+type callerIdentity struct {
+	Account string `xml:"GetCallerIdentityResult>Account"`
+	ARN     string `xml:"GetCallerIdentityResult>Arn"`
+	UserID  string `xml:"GetCallerIdentityResult>UserId"`
+}
+
+// getCallerIdentity calls STS GetCallerIdentity. Vendored sts package predates
+// this call, so request is made with the underlying query client directly.
+func getCallerIdentity(creds aws.CredentialsProvider, region string, client *http.Client) (*callerIdentity, error) {
+	endpoint, service, region := endpoints.Lookup("sts", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	qc := &aws.QueryClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:     client,
+		Endpoint:   endpoint,
+		APIVersion: "2011-06-15",
+	}
+	out := new(callerIdentity)
+	if err := qc.Do("GetCallerIdentity", "POST", "/", nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+var prevgenfmt = "%20s\t%3d vCPU\t%7.1f GiB\t%d\t%s\n"
+
+// instanceType is an item of DescribeInstanceTypes response
+type instanceType struct {
+	Class             string   `xml:"instanceType"`
+	CurrentGeneration bool     `xml:"currentGeneration"`
+	VCPUs             int      `xml:"vCpuInfo>defaultVCpus"`
+	MemoryMiB         int      `xml:"memoryInfo>sizeInMiB"`
+	Architectures     []string `xml:"processorInfo>supportedArchitectures>item"`
+}
+
+// getInstanceTypes returns metadata of EC2 instance types offered in region
+// by their names. Vendored ec2 package has no DescribeInstanceTypes call, so
+// requests are made with the underlying ec2 client directly.
+func getInstanceTypes(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]instanceType, error) {
+	c := newEC2Client(creds, region, client)
+	out := make(map[string]instanceType)
+	req := &describePage{MaxResults: aws.Integer(100)}
+	for {
+		var resp struct {
+			Types     []instanceType `xml:"instanceTypeSet>item"`
+			NextToken string         `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeInstanceTypes", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Types {
+			out[t.Class] = t
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+// familyGeneration splits instance family into its category and generation,
+// i.e. "m" and 5 for m5 or m5n; generation is zero if family has none
+func familyGeneration(family string) (string, int) {
+	i := strings.IndexAny(family, "0123456789")
+	if i < 0 {
+		return family, 0
+	}
+	j := i
+	for j < len(family) && family[j] >= '0' && family[j] <= '9' {
+		j++
+	}
+	n, _ := strconv.Atoi(family[i:j])
+	return family[:i], n
+}
+
+// newerClass returns current generation class of the same category and size
+// as previous generation class, having at least as many vCPUs and as much
+// memory and running on the same architecture. Of such classes the one of the
+// earliest generation is picked, as later ones may cost more. It returns
+// empty string if there's none.
+func newerClass(types map[string]instanceType, class string) string {
+	old, ok := types[class]
+	if !ok {
+		return ""
+	}
+	family := instanceFamily(class)
+	category, gen := familyGeneration(family)
+	size := strings.TrimPrefix(class, family+".")
+	var best string
+	var bestGen int
+	for name, t := range types {
+		if !t.CurrentGeneration || t.VCPUs < old.VCPUs || t.MemoryMiB < old.MemoryMiB ||
+			!sharesArchitecture(old, t) {
+			continue
+		}
+		f := instanceFamily(name)
+		c, g := familyGeneration(f)
+		if c != category || g <= gen || strings.TrimPrefix(name, f+".") != size {
+			continue
+		}
+		if best == "" || g < bestGen || g == bestGen && name < best {
+			best, bestGen = name, g
+		}
+	}
+	return best
+}
+
+// sharesArchitecture reports whether instance types a and b support at least
+// one common architecture
+func sharesArchitecture(a, b instanceType) bool {
+	for _, x := range a.Architectures {
+		for _, y := range b.Architectures {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stringNewerClass describes newer class previous generation instances may
+// move to for report
+func stringNewerClass(class string) string {
+	if class == "" {
+		return "no newer class of the same size"
+	}
+	return "consider " + class + " before reserving"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/cloudwatch"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var lambdafmt = "%30s\t%6d functions\t%14.0f GB-seconds\n"
+
+// lambdaUsage describes Lambda compute usage
+type lambdaUsage struct {
+	Functions int     // number of functions invoked
+	GBSeconds float64 // duration of invocations multiplied by function memory
+}
+
+// getLambdaUsage estimates GB-seconds Lambda functions in region used during
+// the last full day from their Duration metric and configured memory. Lambda
+// bills each invocation rounded up to a millisecond, so the estimate is a
+// little low.
+func getLambdaUsage(lambdaCreds, cwCreds aws.CredentialsProvider, region string, client *http.Client) (lambdaUsage, error) {
+	var out lambdaUsage
+	memory, err := getLambdaMemory(lambdaCreds, region, client)
+	if err != nil {
+		return out, err
+	}
+	period := lastFullDay()
+	start, _ := time.Parse(dateLayout, period["Start"])
+	end, _ := time.Parse(dateLayout, period["End"])
+	cw := cloudwatch.New(cwCreds, region, client)
+	for name, mb := range memory {
+		resp, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/Lambda"),
+			MetricName: aws.String("Duration"),
+			Dimensions: []cloudwatch.Dimension{{
+				Name:  aws.String("FunctionName"),
+				Value: aws.String(name),
+			}},
+			StartTime:  start,
+			EndTime:    end,
+			Period:     aws.Integer(int(end.Sub(start) / time.Second)),
+			Statistics: []string{"Sum"},
+		})
+		if err != nil {
+			return out, err
+		}
+		var ms float64
+		for _, p := range resp.Datapoints {
+			ms += toDouble(p.Sum)
+		}
+		if ms > 0 {
+			out.Functions++
+			out.GBSeconds += ms / 1000 * float64(mb) / 1024
+		}
+	}
+	return out, nil
+}
+
+// getLambdaMemory returns memory size in MB of Lambda functions by name.
+// Vendored lambda package implements long retired API version, so requests
+// are made with the underlying REST client directly.
+func getLambdaMemory(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]int, error) {
+	endpoint, service, region := endpoints.Lookup("lambda", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &aws.RestClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:   client,
+		Endpoint: endpoint,
+	}
+	out := make(map[string]int)
+	var marker string
+	for {
+		q := url.Values{"MaxItems": {"50"}}
+		if marker != "" {
+			q.Set("Marker", marker)
+		}
+		req, err := http.NewRequest("GET", c.Endpoint+"/2015-03-31/functions/?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Functions []struct {
+				FunctionName string
+				MemorySize   int
+			}
+			NextMarker string
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range page.Functions {
+			out[f.FunctionName] = f.MemorySize
+		}
+		if page.NextMarker == "" {
+			return out, nil
+		}
+		marker = page.NextMarker
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var byolfmt = "%20s\t%30s\t%d\n"
+
+// byolKey groups instances bringing their own licenses
+type byolKey struct {
+	Class   string // instance class
+	License string // name of License Manager license configuration
+}
+
+// getLicensedInstances returns names of License Manager license
+// configurations by ids of EC2 instances consuming them. Vendored aws-go has
+// no License Manager client, so requests are made with the underlying JSON
+// client directly.
+func getLicensedInstances(creds aws.CredentialsProvider, region string, client *http.Client) (map[string][]string, error) {
+	c := newLicenseManagerClient(creds, region, client)
+	type config struct {
+		ARN  string `json:"LicenseConfigurationArn"`
+		Name string
+	}
+	var configs []config
+	req := struct {
+		MaxResults int
+		NextToken  string `json:",omitempty"`
+	}{MaxResults: 100}
+	for {
+		var resp struct {
+			LicenseConfigurations []config
+			NextToken             string
+		}
+		if err := c.Do("ListLicenseConfigurations", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		configs = append(configs, resp.LicenseConfigurations...)
+		if resp.NextToken == "" {
+			break
+		}
+		req.NextToken = resp.NextToken
+	}
+	out := make(map[string][]string)
+	for _, cfg := range configs {
+		req := struct {
+			LicenseConfigurationArn string
+			MaxResults              int
+			NextToken               string `json:",omitempty"`
+		}{LicenseConfigurationArn: cfg.ARN, MaxResults: 100}
+		for {
+			var resp struct {
+				LicenseConfigurationUsageList []struct {
+					ResourceArn  string
+					ResourceType string
+				}
+				NextToken string
+			}
+			if err := c.Do("ListUsageForLicenseConfiguration", "POST", "/", req, &resp); err != nil {
+				return nil, err
+			}
+			for _, u := range resp.LicenseConfigurationUsageList {
+				if u.ResourceType != "EC2_INSTANCE" {
+					continue
+				}
+				// arn:aws:ec2:region:account:instance/i-...
+				if i := strings.LastIndex(u.ResourceArn, "instance/"); i >= 0 {
+					id := u.ResourceArn[i+len("instance/"):]
+					out[id] = append(out[id], cfg.Name)
+				}
+			}
+			if resp.NextToken == "" {
+				break
+			}
+			req.NextToken = resp.NextToken
+		}
+	}
+	return out, nil
+}
+
+func newLicenseManagerClient(creds aws.CredentialsProvider, region string, client *http.Client) *aws.JSONClient {
+	endpoint, service, region := endpoints.Lookup("license-manager", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.JSONClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:       client,
+		Endpoint:     endpoint,
+		TargetPrefix: "AWSLicenseManager",
+		JSONVersion:  "1.1",
+	}
+}
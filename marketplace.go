@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/ec2"
+)
+
+var marketfmt = "%20s\t%5s\t%s\t%s\t%d listings, upfront from $%.2f, median $%.2f, median term %d months\n"
+
+// marketStats summarizes Reserved Instance Marketplace listings comparable to
+// some reservation
+type marketStats struct {
+	Listings     int     // number of price points listed
+	MinPrice     float64 // lowest upfront price per instance, USD
+	MedianPrice  float64 // median upfront price per instance, USD
+	MedianMonths int     // median remaining term of listed reservations
+}
+
+// getMarketStats collects prices of Reserved Instance Marketplace listings for
+// the same instance class, platform, tenancy and VPC/EC2-Classic product as
+// k.
+func getMarketStats(creds aws.CredentialsProvider, region string, client *http.Client, k ec2Inst) (marketStats, error) {
+	svc := ec2.New(creds, region, client)
+	req := &ec2.DescribeReservedInstancesOfferingsRequest{
+		IncludeMarketplace: aws.True(),
+		InstanceType:       aws.String(k.Class),
+		Filters: []ec2.Filter{{
+			Name:   aws.String("marketplace"),
+			Values: []string{"true"},
+		}},
+	}
+	var prices []float64
+	var months []int
+	for {
+		resp, err := svc.DescribeReservedInstancesOfferings(req)
+		if err != nil {
+			return marketStats{}, err
+		}
+		for _, o := range resp.ReservedInstancesOfferings {
+			if !toBool(o.Marketplace) ||
+				strings.Contains(toStr(o.ProductDescription), "Amazon VPC") != k.VPC ||
+				ec2Platform(toStr(o.ProductDescription)) != k.Platform ||
+				ec2Tenancy(toStr(o.InstanceTenancy)) != k.Tenancy {
+				continue
+			}
+			term := int(time.Duration(toLong(o.Duration)) * time.Second / (30 * 24 * time.Hour))
+			for _, p := range o.PricingDetails {
+				prices = append(prices, toDouble(p.Price))
+				months = append(months, term)
+			}
+		}
+		if toStr(resp.NextToken) == "" {
+			break
+		}
+		req.NextToken = resp.NextToken
+	}
+	out := marketStats{Listings: len(prices)}
+	if len(prices) == 0 {
+		return out, nil
+	}
+	sort.Float64s(prices)
+	sort.Ints(months)
+	out.MinPrice = prices[0]
+	out.MedianPrice = prices[len(prices)/2]
+	out.MedianMonths = months[len(months)/2]
+	return out, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var medialivefmt = "%8s\t%6s\t%4s\t%12s\t%16s\t%d\n"
+
+// getMediaLive returns both running MediaLive channels and reservations, so
+// that either both or none are available for matching. Channels are matched
+// with channel reservations by their input specification and class; input
+// and output reservations are returned too, but only reported, as output
+// reservations depend on encoder settings. Vendored aws-go has no MediaLive
+// client, so requests are made with the underlying REST client directly.
+func getMediaLive(creds aws.CredentialsProvider, region string, client *http.Client) (running, reserved []mediaLiveInfo, err error) {
+	endpoint, service, region := endpoints.Lookup("medialive", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &aws.RestClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:   client,
+		Endpoint: endpoint,
+	}
+	var channels []mediaLiveChannel
+	err = mediaLiveList(c, "/prod/channels", func(dec *json.Decoder) (string, error) {
+		var page struct {
+			Channels  []mediaLiveChannel `json:"channels"`
+			NextToken string             `json:"nextToken"`
+		}
+		err := dec.Decode(&page)
+		channels = append(channels, page.Channels...)
+		return page.NextToken, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var reservations []mediaLiveReservation
+	err = mediaLiveList(c, "/prod/reservations", func(dec *json.Decoder) (string, error) {
+		var page struct {
+			Reservations []mediaLiveReservation `json:"reservations"`
+			NextToken    string                 `json:"nextToken"`
+		}
+		err := dec.Decode(&page)
+		reservations = append(reservations, page.Reservations...)
+		return page.NextToken, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ch := range channels {
+		running = append(running, mlcTomli(ch))
+	}
+	for _, r := range reservations {
+		reserved = append(reserved, mlrTomli(r))
+	}
+	return running, reserved, nil
+}
+
+// mediaLiveList calls paginated MediaLive List* operation at path, decoding
+// each page with page function, which returns token of the next page.
+func mediaLiveList(c *aws.RestClient, path string, page func(*json.Decoder) (string, error)) error {
+	q := url.Values{"maxResults": {"100"}}
+	for {
+		req, err := http.NewRequest("GET", c.Endpoint+path+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		next, err := page(json.NewDecoder(resp.Body))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		q.Set("nextToken", next)
+	}
+}
+
+// mediaLiveSpec is input specification of channel and resource specification
+// of reservation
+type mediaLiveSpec struct {
+	ResourceType   string `json:"resourceType"` // INPUT, OUTPUT or CHANNEL
+	Codec          string `json:"codec"`
+	Resolution     string `json:"resolution"`
+	MaximumBitrate string `json:"maximumBitrate"`
+	ChannelClass   string `json:"channelClass"`
+}
+
+// mediaLiveChannel is an item of ListChannels response
+type mediaLiveChannel struct {
+	State        string        `json:"state"`
+	ChannelClass string        `json:"channelClass"`
+	Input        mediaLiveSpec `json:"inputSpecification"`
+}
+
+// mediaLiveReservation is an item of ListReservations response
+type mediaLiveReservation struct {
+	Count int           `json:"count"`
+	State string        `json:"state"`
+	Start string        `json:"start"`
+	End   string        `json:"end"`
+	Spec  mediaLiveSpec `json:"resourceSpecification"`
+}
+
+// mlcTomli converts mediaLiveChannel to mediaLiveInfo. State is set to Active
+// for running channels, as idle ones are not billed.
+func mlcTomli(ch mediaLiveChannel) mediaLiveInfo {
+	out := mediaLiveInfo{
+		mediaLiveKey: mediaLiveKey{
+			Resource:   "CHANNEL",
+			Codec:      ch.Input.Codec,
+			Resolution: ch.Input.Resolution,
+			Bitrate:    ch.Input.MaximumBitrate,
+			Class:      ch.ChannelClass,
+		},
+		Count:  1,
+		Status: ch.State,
+	}
+	switch out.Status {
+	case "RUNNING", "STARTING", "UPDATING":
+		out.State = Active
+	}
+	return out
+}
+
+// mlrTomli converts mediaLiveReservation to mediaLiveInfo
+func mlrTomli(r mediaLiveReservation) mediaLiveInfo {
+	out := mediaLiveInfo{
+		mediaLiveKey: mediaLiveKey{
+			Resource:   r.Spec.ResourceType,
+			Codec:      r.Spec.Codec,
+			Resolution: r.Spec.Resolution,
+			Bitrate:    r.Spec.MaximumBitrate,
+			Class:      r.Spec.ChannelClass,
+		},
+		Count:  r.Count,
+		Status: r.State,
+	}
+	// times are in ISO 8601 without zone, which is UTC
+	out.Start, _ = time.Parse("2006-01-02T15:04:05", r.Start)
+	out.End, _ = time.Parse("2006-01-02T15:04:05", r.End)
+	switch out.Status {
+	case "ACTIVE":
+		out.State = Active
+		// reservations may be purchased to start later
+		if out.Start.After(time.Now()) {
+			out.State = Pending
+		}
+	}
+	return out
+}
+
+// mediaLiveInfo describes a group of MediaLive channels or reservations
+// having the same state
+type mediaLiveInfo struct {
+	mediaLiveKey
+	Count  int       // number of channels or reserved resources in group
+	State  state     // state of group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for channels
+	End    time.Time // reservation end time, zero for channels
+}
+
+// mediaLiveKey describes MediaLive resource reservations apply to
+type mediaLiveKey struct {
+	Resource   string // CHANNEL, INPUT or OUTPUT
+	Codec      string // AVC, HEVC or MPEG2
+	Resolution string // SD, HD, FHD or UHD
+	Bitrate    string // MAX_10_MBPS, MAX_20_MBPS or MAX_50_MBPS
+	Class      string // STANDARD or SINGLE_PIPELINE
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var memorydbfmt = "%20s\t%d\n"
+
+// getMemoryDBNodes returns both running and reserved MemoryDB nodes, so that
+// either both or none are available for matching. Vendored aws-go has no
+// MemoryDB client, so requests are made with the underlying JSON client
+// directly.
+func getMemoryDBNodes(creds aws.CredentialsProvider, region string, client *http.Client) (running, reserved []memoryDBNodeInfo, err error) {
+	c := newMemoryDBClient(creds, region, client)
+	if running, err = getRunningMemoryDBNodes(c); err != nil {
+		return nil, nil, err
+	}
+	if reserved, err = getReservedMemoryDBNodes(c); err != nil {
+		return nil, nil, err
+	}
+	return running, reserved, nil
+}
+
+// memoryDBCluster is an item of DescribeClusters response
+type memoryDBCluster struct {
+	Status         string
+	NodeType       string
+	NumberOfShards int
+	Shards         []struct {
+		NumberOfNodes int // primary and its replicas
+	}
+}
+
+func getRunningMemoryDBNodes(c *aws.JSONClient) ([]memoryDBNodeInfo, error) {
+	req := struct {
+		ShowShardDetails bool
+		NextToken        string `json:",omitempty"`
+	}{ShowShardDetails: true}
+	var out []memoryDBNodeInfo
+	for {
+		var resp struct {
+			Clusters  []memoryDBCluster
+			NextToken string
+		}
+		if err := c.Do("DescribeClusters", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, cl := range resp.Clusters {
+			out = append(out, mdbcTomdbni(cl))
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// memoryDBReservedNode is an item of DescribeReservedNodes response
+type memoryDBReservedNode struct {
+	NodeType  string
+	NodeCount int
+	State     string
+	StartTime float64 // seconds since epoch
+	Duration  int     // seconds
+}
+
+func getReservedMemoryDBNodes(c *aws.JSONClient) ([]memoryDBNodeInfo, error) {
+	req := struct {
+		NextToken string `json:",omitempty"`
+	}{}
+	var out []memoryDBNodeInfo
+	for {
+		var resp struct {
+			ReservedNodes []memoryDBReservedNode
+			NextToken     string
+		}
+		if err := c.Do("DescribeReservedNodes", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.ReservedNodes {
+			out = append(out, mdbrnTomdbni(r))
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// mdbcTomdbni converts memoryDBCluster to memoryDBNodeInfo. Count is the
+// number of nodes in all shards, each having a primary and replicas. State is
+// set to Active for clusters that are being created, available or updated.
+func mdbcTomdbni(c memoryDBCluster) memoryDBNodeInfo {
+	out := memoryDBNodeInfo{
+		memoryDBNode: memoryDBNode{
+			Class: c.NodeType,
+		},
+		Status: c.Status,
+	}
+	for _, s := range c.Shards {
+		out.Count += s.NumberOfNodes
+	}
+	if len(c.Shards) == 0 {
+		// without shard details only primaries are known
+		out.Count = c.NumberOfShards
+	}
+	switch out.Status {
+	case "available", "creating", "updating", "snapshotting":
+		out.State = Active
+	}
+	return out
+}
+
+// mdbrnTomdbni converts memoryDBReservedNode to memoryDBNodeInfo
+func mdbrnTomdbni(r memoryDBReservedNode) memoryDBNodeInfo {
+	start := time.Unix(0, int64(r.StartTime*float64(time.Second))).UTC()
+	out := memoryDBNodeInfo{
+		memoryDBNode: memoryDBNode{
+			Class: r.NodeType,
+		},
+		Count:  r.NodeCount,
+		Status: r.State,
+		Start:  start,
+		End:    start.Add(time.Duration(r.Duration) * time.Second),
+	}
+	switch out.Status {
+	case "active":
+		out.State = Active
+	case "payment-pending":
+		out.State = Pending
+	}
+	return out
+}
+
+func newMemoryDBClient(creds aws.CredentialsProvider, region string, client *http.Client) *aws.JSONClient {
+	endpoint, _, region := endpoints.Lookup("memory-db", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.JSONClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     "memorydb", // differs from endpoint name
+			Region:      region,
+		},
+		Client:       client,
+		Endpoint:     endpoint,
+		TargetPrefix: "AmazonMemoryDB",
+		JSONVersion:  "1.1",
+	}
+}
+
+// memoryDBNodeInfo describes a group of MemoryDB nodes having the same state
+type memoryDBNodeInfo struct {
+	memoryDBNode
+	Count  int       // number of nodes in group
+	State  state     // state of nodes in group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for nodes
+	End    time.Time // reservation end time, zero for nodes
+}
+
+// memoryDBNode describes single MemoryDB node
+type memoryDBNode struct {
+	Class string // node type (i.e. db.r6g.large)
+}
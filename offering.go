@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+var unusedfmt = "%20s\t%5s\t%s\t%s\t%d\t%s%s\n"
+
+// getOfferingClasses returns offering class (standard or convertible) of EC2
+// reservations by their ids. Vendored ec2 package predates convertible
+// reservations, so requests are made with the underlying ec2 client directly.
+func getOfferingClasses(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]string, error) {
+	c := newEC2Client(creds, region, client)
+	var resp struct {
+		Reservations []struct {
+			ID            string `xml:"reservedInstancesId"`
+			OfferingClass string `xml:"offeringClass"`
+		} `xml:"reservedInstancesSet>item"`
+	}
+	if err := c.Do("DescribeReservedInstances", "POST", "/", &struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	for _, r := range resp.Reservations {
+		out[r.ID] = r.OfferingClass
+	}
+	return out, nil
+}
+
+// stringOfferingClasses returns offering classes of reservations for report:
+// single class if all reservations are of the same one, otherwise number of
+// reservations of each
+func stringOfferingClasses(classes map[string]int) string {
+	if len(classes) == 1 {
+		for c := range classes {
+			return c
+		}
+	}
+	var names []string
+	for c := range classes {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+	var out []string
+	for _, c := range names {
+		out = append(out, strconv.Itoa(classes[c])+" "+c)
+	}
+	return strings.Join(out, ", ")
+}
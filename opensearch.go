@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var (
+	searchfmt     = "%20s\t%d\n"
+	searchkindfmt = "%20s\t%16s\t%d\n"
+	searchcoldfmt = "%20s\t%16s\t%d domains\n"
+)
+
+// kinds of OpenSearch nodes
+const (
+	searchData   = "data"
+	searchMaster = "dedicated master"
+	searchWarm   = "UltraWarm"
+	searchCold   = "cold storage"
+)
+
+// getSearchNodes returns both running and reserved OpenSearch nodes, so that
+// either both or none are available for matching. Vendored aws-go has no
+// OpenSearch client, so requests are made with the underlying REST client
+// directly.
+func getSearchNodes(creds aws.CredentialsProvider, region string, client *http.Client) (running, reserved []searchNodeInfo, err error) {
+	c := newSearchClient(creds, region, client)
+	if running, err = getRunningSearchNodes(c); err != nil {
+		return nil, nil, err
+	}
+	if reserved, err = getReservedSearchNodes(c); err != nil {
+		return nil, nil, err
+	}
+	return running, reserved, nil
+}
+
+func newSearchClient(creds aws.CredentialsProvider, region string, client *http.Client) *aws.RestClient {
+	endpoint, service, region := endpoints.Lookup("es", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.RestClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     service,
+			Region:      region,
+		},
+		Client:   client,
+		Endpoint: endpoint,
+	}
+}
+
+// searchDo makes OpenSearch API request, sending body as JSON unless it's nil,
+// and decodes response into out
+func searchDo(c *aws.RestClient, method, path string, q url.Values, body, out interface{}) error {
+	u := c.Endpoint + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// searchCluster is ClusterConfig of OpenSearch domain
+type searchCluster struct {
+	InstanceType           string
+	InstanceCount          int
+	DedicatedMasterEnabled bool
+	DedicatedMasterType    string
+	DedicatedMasterCount   int
+	WarmEnabled            bool
+	WarmType               string
+	WarmCount              int
+	ColdStorageOptions     struct{ Enabled bool }
+}
+
+func getRunningSearchNodes(c *aws.RestClient) ([]searchNodeInfo, error) {
+	var names struct {
+		DomainNames []struct{ DomainName string }
+	}
+	if err := searchDo(c, "GET", "/2021-01-01/domain", nil, nil, &names); err != nil {
+		return nil, err
+	}
+	var out []searchNodeInfo
+	// DescribeDomains takes up to 5 domains at once
+	for domains := names.DomainNames; len(domains) > 0; {
+		n := len(domains)
+		if n > 5 {
+			n = 5
+		}
+		var req struct{ DomainNames []string }
+		for _, d := range domains[:n] {
+			req.DomainNames = append(req.DomainNames, d.DomainName)
+		}
+		domains = domains[n:]
+		var resp struct {
+			DomainStatusList []struct {
+				Deleted       bool
+				ClusterConfig searchCluster
+			}
+		}
+		if err := searchDo(c, "POST", "/2021-01-01/opensearch/domain-info", nil, req, &resp); err != nil {
+			return nil, err
+		}
+		for _, d := range resp.DomainStatusList {
+			if d.Deleted {
+				continue
+			}
+			out = append(out, oscToosni(d.ClusterConfig)...)
+		}
+	}
+	return out, nil
+}
+
+// searchReservation is an item of DescribeReservedInstances and
+// DescribeReservedElasticsearchInstances responses, the latter using field
+// names prefixed with Elasticsearch
+type searchReservation struct {
+	ID        string  `json:"ReservedInstanceId"`
+	Class     string  `json:"InstanceType"`
+	Count     int     `json:"InstanceCount"`
+	State     string  `json:"State"`
+	StartTime float64 `json:"StartTime"` // seconds since epoch
+	Duration  int     `json:"Duration"`  // seconds
+}
+
+// getReservedSearchNodes returns OpenSearch reservations, merging ones the
+// legacy Elasticsearch API reports, as some older reservations only show up
+// there.
+func getReservedSearchNodes(c *aws.RestClient) ([]searchNodeInfo, error) {
+	seen := make(map[string]bool)
+	var out []searchNodeInfo
+	q := url.Values{"maxResults": {"100"}}
+	for {
+		var resp struct {
+			ReservedInstances []searchReservation
+			NextToken         string
+		}
+		if err := searchDo(c, "GET", "/2021-01-01/opensearch/reservedInstances", q, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.ReservedInstances {
+			seen[r.ID] = true
+			out = append(out, osrToosni(r))
+		}
+		if resp.NextToken == "" {
+			break
+		}
+		q.Set("nextToken", resp.NextToken)
+	}
+	q = url.Values{"maxResults": {"100"}}
+	for {
+		var resp struct {
+			ReservedInstances []struct {
+				ID        string  `json:"ReservedElasticsearchInstanceId"`
+				Class     string  `json:"ElasticsearchInstanceType"`
+				Count     int     `json:"ElasticsearchInstanceCount"`
+				State     string  `json:"State"`
+				StartTime float64 `json:"StartTime"`
+				Duration  int     `json:"Duration"`
+			} `json:"ReservedElasticsearchInstances"`
+			NextToken string
+		}
+		if err := searchDo(c, "GET", "/2015-01-01/es/reservedInstances", q, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.ReservedInstances {
+			if seen[r.ID] {
+				continue
+			}
+			seen[r.ID] = true
+			out = append(out, osrToosni(searchReservation(r)))
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		q.Set("nextToken", resp.NextToken)
+	}
+}
+
+// oscToosni converts cluster config of OpenSearch domain to searchNodeInfo,
+// one per kind of nodes it has: data, dedicated master, UltraWarm and cold
+// storage. Cold storage has no nodes of its own, so it's a single group with
+// no class per domain.
+func oscToosni(cfg searchCluster) []searchNodeInfo {
+	out := []searchNodeInfo{{
+		searchNode: searchNode{Class: searchClass(cfg.InstanceType)},
+		Kind:       searchData,
+		Count:      cfg.InstanceCount,
+		State:      Active,
+		Status:     "active",
+	}}
+	if cfg.DedicatedMasterEnabled {
+		out = append(out, searchNodeInfo{
+			searchNode: searchNode{Class: searchClass(cfg.DedicatedMasterType)},
+			Kind:       searchMaster,
+			Count:      cfg.DedicatedMasterCount,
+			State:      Active,
+			Status:     "active",
+		})
+	}
+	if cfg.WarmEnabled {
+		out = append(out, searchNodeInfo{
+			searchNode: searchNode{Class: searchClass(cfg.WarmType)},
+			Kind:       searchWarm,
+			Count:      cfg.WarmCount,
+			State:      Active,
+			Status:     "active",
+		})
+	}
+	if cfg.ColdStorageOptions.Enabled {
+		out = append(out, searchNodeInfo{
+			Kind:   searchCold,
+			Count:  1,
+			State:  Active,
+			Status: "active",
+		})
+	}
+	return out
+}
+
+// searchKindKey groups OpenSearch nodes by kind for report
+type searchKindKey struct {
+	Kind  string // kind of nodes
+	Class string // instance type, empty for cold storage
+}
+
+// searchKindOrder returns position of kind of OpenSearch nodes in report
+func searchKindOrder(kind string) int {
+	for i, k := range []string{searchData, searchMaster, searchWarm, searchCold} {
+		if k == kind {
+			return i
+		}
+	}
+	return -1
+}
+
+// reservable reports whether reservations apply to nodes of group: they
+// don't to UltraWarm nodes and cold storage
+func (ii searchNodeInfo) reservable() bool {
+	return ii.Kind != searchWarm && ii.Kind != searchCold
+}
+
+// osrToosni converts searchReservation to searchNodeInfo
+func osrToosni(r searchReservation) searchNodeInfo {
+	start := time.Unix(0, int64(r.StartTime*float64(time.Second))).UTC()
+	out := searchNodeInfo{
+		searchNode: searchNode{Class: searchClass(r.Class)},
+		Count:      r.Count,
+		Status:     r.State,
+		Start:      start,
+		End:        start.Add(time.Duration(r.Duration) * time.Second),
+	}
+	switch out.Status {
+	case "active":
+		out.State = Active
+	case "payment-pending":
+		out.State = Pending
+	}
+	return out
+}
+
+// searchClass returns instance type without suffix legacy Elasticsearch API
+// (.elasticsearch) or OpenSearch API (.search) adds, so that both match
+func searchClass(s string) string {
+	for _, sfx := range []string{".elasticsearch", ".search"} {
+		if strings.HasSuffix(s, sfx) {
+			return strings.TrimSuffix(s, sfx)
+		}
+	}
+	return s
+}
+
+// searchNodeInfo describes a group of OpenSearch nodes having the same state
+type searchNodeInfo struct {
+	searchNode
+	Kind   string    // kind of nodes (data, dedicated master, etc.), empty for reservations
+	Count  int       // number of nodes in group
+	State  state     // state of nodes in group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for nodes
+	End    time.Time // reservation end time, zero for nodes
+}
+
+// searchNode describes single OpenSearch node
+type searchNode struct {
+	Class string // instance type without suffix (i.e. r6g.large)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// redirectStdout makes everything written to standard output go to w instead,
+// until returned function is called.
+func redirectStdout(w io.Writer) (func(), error) {
+	stdout := os.Stdout
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	os.Stdout = pw
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := io.Copy(w, pr); err != nil {
+			// w is gone (i.e. pager quit early), keep reading so
+			// later writes to stdout don't block
+			io.Copy(io.Discard, pr)
+		}
+	}()
+	return func() {
+		os.Stdout = stdout
+		pw.Close()
+		<-done
+	}, nil
+}
+
+// limitWriter passes at most limit lines of each report section through,
+// replacing the rest with a line telling how many were left out. Sections are
+// separated by empty lines and start with a header line, which is not
+// counted.
+type limitWriter struct {
+	w       io.Writer
+	limit   int
+	line    []byte // incomplete line
+	n       int    // lines of current section seen so far
+	omitted int    // lines of current section left out
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lw.line = append(lw.line, p...)
+	for {
+		i := bytes.IndexByte(lw.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := lw.writeLine(lw.line[:i+1]); err != nil {
+			return 0, err
+		}
+		lw.line = lw.line[i+1:]
+	}
+}
+
+func (lw *limitWriter) writeLine(line []byte) error {
+	if len(line) == 1 {
+		if err := lw.flush(); err != nil {
+			return err
+		}
+		lw.n = 0
+	} else {
+		lw.n++
+	}
+	if lw.n > lw.limit+1 {
+		lw.omitted++
+		return nil
+	}
+	_, err := lw.w.Write(line)
+	return err
+}
+
+// flush reports lines left out of the current section, if any
+func (lw *limitWriter) flush() error {
+	if lw.omitted == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(lw.w, "\tand %d more…\n", lw.omitted)
+	lw.omitted = 0
+	return err
+}
+
+// limitStdout limits each section of report written to standard output to
+// limit lines until returned function is called.
+func limitStdout(limit int) (func(), error) {
+	lw := &limitWriter{w: os.Stdout, limit: limit}
+	restore, err := redirectStdout(lw)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		restore()
+		lw.w.Write(lw.line)
+		lw.flush()
+	}, nil
+}
+
+// startPager pipes standard output through $PAGER (less by default) until
+// returned function is called, which waits for pager to exit. Output is left
+// as is if it does not go to a terminal.
+func startPager() (func(), error) {
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return func() {}, nil
+	}
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 {
+		args = []string{"less"}
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if os.Getenv("LESS") == "" {
+		// quit if report fits the screen, as git does
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	restore, err := redirectStdout(w)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		restore()
+		w.Close()
+		cmd.Wait()
+	}, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+var zonalfmt = "%20s\t%5s\t%s\t%s\t%12s\t%d\t%s%s\n"
+
+// zonalKey groups instances and zonal reservations by availability zone
+type zonalKey struct {
+	ec2Inst
+	Zone string // availability zone
+}
+
+// newZonalKey returns zonalKey of instance or reservation with key k in zone.
+// Tag is cleared, so zonal reservations match instances of any tag group
+// there; ei is settled across tag groups afterwards.
+func newZonalKey(k ec2Inst, zone string) zonalKey {
+	k.Tag = ""
+	return zonalKey{ec2Inst: k, Zone: zone}
+}
+
+// ec2Tenancy returns instance or reservation tenancy as used in ec2Inst,
+// empty for default one
+func ec2Tenancy(s string) string {
+	if s == "default" {
+		return ""
+	}
+	return s
+}
+
+// stringTenancy returns tenancy name for report
+func stringTenancy(s string) string {
+	if s == "" {
+		return "default"
+	}
+	return s
+}
+
+// placementKey groups instances which can't be covered by reservations
+type placementKey struct {
+	Class     string // instance class
+	Placement string // zone, prefixed with "outpost" for Outposts
+}
+
+// isLocalZone reports whether availability zone of region is a Local Zone or
+// Wavelength Zone (i.e. us-west-2-lax-1a or us-east-1-wl1-bos-wlz-1) rather
+// than a regular one, named as region followed by a letter.
+func isLocalZone(zone, region string) bool {
+	return strings.HasPrefix(zone, region+"-")
+}
+
+// getOutpostSubnets returns ids of subnets on AWS Outposts. Vendored ec2
+// package predates Outposts, so requests are made with the underlying ec2
+// client directly.
+func getOutpostSubnets(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]bool, error) {
+	c := newEC2Client(creds, region, client)
+	out := make(map[string]bool)
+	req := &describePage{MaxResults: aws.Integer(1000)}
+	for {
+		var resp struct {
+			Subnets []struct {
+				ID         string `xml:"subnetId"`
+				OutpostARN string `xml:"outpostArn"`
+			} `xml:"subnetSet>item"`
+			NextToken string `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeSubnets", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Subnets {
+			if s.OutpostARN != "" {
+				out[s.ID] = true
+			}
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
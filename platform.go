@@ -0,0 +1,23 @@
+package main
+
+import "strings"
+
+// ec2Platform returns platform of reservation product description (i.e.
+// "Windows (Amazon VPC)") or instance platform details (i.e. "Red Hat
+// Enterprise Linux") as used in ec2Inst: the same for both, and empty for
+// Linux/UNIX.
+func ec2Platform(s string) string {
+	s = strings.TrimSuffix(s, " (Amazon VPC)")
+	if s == "Linux/UNIX" {
+		return ""
+	}
+	return s
+}
+
+// stringPlatform returns platform name for report
+func stringPlatform(s string) string {
+	if s == "" {
+		return "Linux/UNIX"
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+var reconcilefmt = "%20s\t%6d used\t%6d ignored\n"
+
+// tally counts instances or reservations by state reported by AWS, separating
+// the ones used in matching from ignored ones
+type tally map[string]*[2]int
+
+func (t tally) add(status string, n int, used bool) {
+	c, ok := t[status]
+	if !ok {
+		c = new([2]int)
+		t[status] = c
+	}
+	if used {
+		c[0] += n
+	} else {
+		c[1] += n
+	}
+}
+
+func (t tally) print(title string) {
+	fmt.Printf("\n%s:\n", title)
+	var keys []string
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var total [2]int
+	for _, k := range keys {
+		c := t[k]
+		if k == "" {
+			k = "unknown"
+		}
+		fmt.Printf(reconcilefmt, k, c[0], c[1])
+		total[0] += c[0]
+		total[1] += c[1]
+	}
+	fmt.Printf(reconcilefmt, "total", total[0], total[1])
+}
+
+// printReconcile prints totals of fetched instances and reservations by their
+// AWS state next to how many of them were used in matching.
+func printReconcile(ec2Used func(ec2InstInfo) bool, rdsUsed func(rdsInstInfo) bool,
+	cacheUsed func(cacheNodeInfo) bool, redshiftUsed func(redshiftNodeInfo) bool,
+	hostUsed func(hostInfo) bool, memorydbUsed func(memoryDBNodeInfo) bool,
+	searchUsed func(searchNodeInfo) bool,
+	runningEi, reservedEi []ec2InstInfo, runningRi, reservedRi []rdsInstInfo,
+	runningCi, reservedCi []cacheNodeInfo, runningSi, reservedSi []redshiftNodeInfo,
+	runningHi, reservedHi []hostInfo, runningMi, reservedMi []memoryDBNodeInfo,
+	runningOi, reservedOi []searchNodeInfo) {
+	t := make(tally)
+	for _, ii := range runningEi {
+		t.add(ii.Status, ii.Count, ec2Used(ii))
+	}
+	t.print("EC2 instances")
+	t = make(tally)
+	for _, ii := range reservedEi {
+		t.add(ii.Status, ii.Count, ec2Used(ii))
+	}
+	t.print("EC2 reservations")
+	t = make(tally)
+	for _, ii := range runningRi {
+		t.add(ii.Status, ii.Count, rdsUsed(ii))
+	}
+	t.print("RDS instances")
+	t = make(tally)
+	for _, ii := range reservedRi {
+		t.add(ii.Status, ii.Count, rdsUsed(ii))
+	}
+	t.print("RDS reservations")
+	t = make(tally)
+	for _, ii := range runningCi {
+		t.add(ii.Status, ii.Count, cacheUsed(ii))
+	}
+	t.print("ElastiCache nodes")
+	t = make(tally)
+	for _, ii := range reservedCi {
+		t.add(ii.Status, ii.Count, cacheUsed(ii))
+	}
+	t.print("ElastiCache reservations")
+	t = make(tally)
+	for _, ii := range runningSi {
+		t.add(ii.Status, ii.Count, redshiftUsed(ii))
+	}
+	t.print("Redshift nodes")
+	t = make(tally)
+	for _, ii := range reservedSi {
+		t.add(ii.Status, ii.Count, redshiftUsed(ii))
+	}
+	t.print("Redshift reservations")
+	t = make(tally)
+	for _, ii := range runningHi {
+		t.add(ii.Status, ii.Count, hostUsed(ii))
+	}
+	t.print("Dedicated Hosts")
+	t = make(tally)
+	for _, ii := range reservedHi {
+		t.add(ii.Status, ii.Count, hostUsed(ii))
+	}
+	t.print("Dedicated Host reservations")
+	t = make(tally)
+	for _, ii := range runningMi {
+		t.add(ii.Status, ii.Count, memorydbUsed(ii))
+	}
+	t.print("MemoryDB nodes")
+	t = make(tally)
+	for _, ii := range reservedMi {
+		t.add(ii.Status, ii.Count, memorydbUsed(ii))
+	}
+	t.print("MemoryDB reservations")
+	t = make(tally)
+	for _, ii := range runningOi {
+		t.add(ii.Status, ii.Count, searchUsed(ii))
+	}
+	t.print("OpenSearch nodes")
+	t = make(tally)
+	for _, ii := range reservedOi {
+		t.add(ii.Status, ii.Count, searchUsed(ii))
+	}
+	t.print("OpenSearch reservations")
+}
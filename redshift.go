@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/redshift"
+)
+
+var (
+	redshiftfmt       = "%20s\t%d\n"
+	redshiftresizefmt = "%30s\t%20s\t%d\t->\t%20s\t%d\n"
+)
+
+// getRedshiftNodes returns both running and reserved Redshift nodes, so that
+// either both or none are available for matching.
+func getRedshiftNodes(creds aws.CredentialsProvider, region string, client *http.Client) (running, reserved []redshiftNodeInfo, err error) {
+	if running, err = getRunningRedshiftNodes(creds, region, client); err != nil {
+		return nil, nil, err
+	}
+	if reserved, err = getReservedRedshiftNodes(creds, region, client); err != nil {
+		return nil, nil, err
+	}
+	return running, reserved, nil
+}
+
+func getRunningRedshiftNodes(creds aws.CredentialsProvider, region string, client *http.Client) ([]redshiftNodeInfo, error) {
+	rc := redshift.New(creds, region, client)
+	req := &redshift.DescribeClustersMessage{MaxRecords: aws.Integer(100)}
+	var out []redshiftNodeInfo
+	for {
+		resp, err := rc.DescribeClusters(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range resp.Clusters {
+			out = append(out, rscTorsni(c))
+		}
+		if toStr(resp.Marker) == "" {
+			return out, nil
+		}
+		req.Marker = resp.Marker
+	}
+}
+
+func getReservedRedshiftNodes(creds aws.CredentialsProvider, region string, client *http.Client) ([]redshiftNodeInfo, error) {
+	rc := redshift.New(creds, region, client)
+	req := &redshift.DescribeReservedNodesMessage{MaxRecords: aws.Integer(100)}
+	var out []redshiftNodeInfo
+	for {
+		resp, err := rc.DescribeReservedNodes(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.ReservedNodes {
+			out = append(out, rsrnTorsni(r))
+		}
+		if toStr(resp.Marker) == "" {
+			return out, nil
+		}
+		req.Marker = resp.Marker
+	}
+}
+
+// rscTorsni converts redshift.Cluster to redshiftNodeInfo. State is set to
+// Active for all clusters except for the ones being deleted, failed or paused,
+// as paused clusters are not billed for compute. Clusters scheduled for resize
+// are described by their target node type and count, as that's what
+// reservations should match once resize completes; current ones are kept in
+// From fields.
+func rscTorsni(c redshift.Cluster) redshiftNodeInfo {
+	out := redshiftNodeInfo{
+		redshiftNode: redshiftNode{
+			Class: toStr(c.NodeType),
+		},
+		ID:     toStr(c.ClusterIdentifier),
+		Count:  toInt(c.NumberOfNodes),
+		Status: toStr(c.ClusterStatus),
+		State:  Active,
+	}
+	if p := c.PendingModifiedValues; p != nil {
+		class, count := toStr(p.NodeType), toInt(p.NumberOfNodes)
+		if class != "" || count != 0 {
+			out.FromClass, out.FromCount = out.Class, out.Count
+		}
+		if class != "" {
+			out.Class = class
+		}
+		if count != 0 {
+			out.Count = count
+		}
+	}
+	switch {
+	case out.Status == "deleting",
+		out.Status == "final-snapshot",
+		out.Status == "hardware-failure",
+		out.Status == "paused",
+		strings.HasPrefix(out.Status, "incompatible-"):
+		out.State = UnknownState
+	}
+	return out
+}
+
+// rsrnTorsni converts redshift.ReservedNode to redshiftNodeInfo
+func rsrnTorsni(r redshift.ReservedNode) redshiftNodeInfo {
+	out := redshiftNodeInfo{
+		redshiftNode: redshiftNode{
+			Class: toStr(r.NodeType),
+		},
+		Count:  toInt(r.NodeCount),
+		Status: toStr(r.State),
+		Start:  r.StartTime,
+		End:    r.StartTime.Add(time.Duration(toInt(r.Duration)) * time.Second),
+	}
+	switch out.Status {
+	case "active":
+		out.State = Active
+	case "pending-payment":
+		out.State = Pending
+	}
+	return out
+}
+
+// redshiftNodeInfo describes a group of Redshift nodes having the same state
+type redshiftNodeInfo struct {
+	redshiftNode
+	ID     string    // cluster identifier, empty for reservations
+	Count  int       // number of nodes in group
+	State  state     // state of nodes in group
+	Status string    // state as reported by AWS
+	Start  time.Time // reservation start time, zero for nodes
+	End    time.Time // reservation end time, zero for nodes
+
+	// current node type and count of cluster scheduled for resize, empty
+	// otherwise
+	FromClass string
+	FromCount int
+}
+
+// resizing reports whether cluster is scheduled for resize
+func (ii redshiftNodeInfo) resizing() bool {
+	return ii.FromClass != ""
+}
+
+// redshiftNode describes single Redshift node
+type redshiftNode struct {
+	Class string // node type (i.e. dw2.large)
+}
+
+// exchangeableForRA3 reports whether reserved nodes of class can be exchanged
+// for RA3 ones. Reserved nodes only apply to clusters of exactly the same node
+// type, so these are the only ones clusters moved to RA3 can still use.
+func exchangeableForRA3(class string) bool {
+	return strings.HasPrefix(class, "dc2.") || strings.HasPrefix(class, "ds2.")
+}
@@ -0,0 +1,195 @@
+//go:build ignore
+
+// Command release builds static binaries of aws-reservations for supported
+// platforms into dist directory, along with SHA256SUMS file listing their
+// checksums.
+//
+// Repository has no go.mod: it builds in GOPATH mode, with aws-go vendored
+// and other dependencies checked out in GOPATH by git. Check out repository as
+// $GOPATH/src/github.com/artyom/aws-reservations and run from there:
+//
+//	GO111MODULE=off go run release.go -version v1.2.3
+//
+// Dependency revisions are pinned in DEPENDENCIES file, and release refuses to
+// build unless GOPATH checkouts are clean and at pinned revisions. After
+// updating dependencies, pin their current revisions with:
+//
+//	GO111MODULE=off go run release.go -pin
+//
+// Builds are reproducible: the same source, dependency revisions and Go
+// version produce the same binaries, so anyone can rebuild a release and
+// compare checksums.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dependencies are packages build needs which are neither vendored nor part
+// of standard library
+var dependencies = []string{
+	"github.com/artyom/autoflags",
+	"github.com/juju/errors",
+	"github.com/vaughan0/go-ini",
+}
+
+// pinFile lists pinned dependency revisions, one "import-path revision" pair
+// per line
+const pinFile = "DEPENDENCIES"
+
+var targets = []struct{ goos, goarch string }{
+	{"linux", "amd64"},
+	{"linux", "arm64"},
+	{"darwin", "amd64"},
+	{"darwin", "arm64"},
+	{"windows", "amd64"},
+}
+
+func main() {
+	log.SetFlags(0)
+	version := flag.String("version", "", "version to embed into binaries (required)")
+	dir := flag.String("dir", "dist", "directory to put binaries into")
+	pin := flag.Bool("pin", false, "record current dependency revisions in "+pinFile+" and exit")
+	flag.Parse()
+	if *pin {
+		if err := pinDependencies(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *version == "" {
+		log.Fatal("-version is required")
+	}
+	if err := checkDependencies(); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	var sums strings.Builder
+	for _, t := range targets {
+		name := fmt.Sprintf("aws-reservations-%s-%s-%s", *version, t.goos, t.goarch)
+		if t.goos == "windows" {
+			name += ".exe"
+		}
+		out := filepath.Join(*dir, name)
+		cmd := exec.Command("go", "build", "-trimpath",
+			"-ldflags", "-s -w -buildid= -X main.version="+*version,
+			"-o", out, ".")
+		cmd.Env = append(os.Environ(), "GO111MODULE=off",
+			"CGO_ENABLED=0", "GOOS="+t.goos, "GOARCH="+t.goarch)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		log.Printf("building %s", out)
+		if err := cmd.Run(); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		sum, err := sha256File(out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&sums, "%x  %s\n", sum, name)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, "SHA256SUMS"), []byte(sums.String()), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func sha256File(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// revision returns git revision of GOPATH checkout of package, failing if
+// checkout has uncommitted changes
+func revision(pkg string) (string, error) {
+	dir, err := goOutput("list", "-f", "{{.Dir}}", pkg)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", pkg, err)
+	}
+	status, err := output(exec.Command("git", "-C", dir, "status", "--porcelain"))
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", pkg, err)
+	}
+	if status != "" {
+		return "", fmt.Errorf("%s: %s has uncommitted changes", pkg, dir)
+	}
+	return output(exec.Command("git", "-C", dir, "rev-parse", "HEAD"))
+}
+
+// pinDependencies writes current revisions of dependencies to pinFile
+func pinDependencies() error {
+	var buf bytes.Buffer
+	for _, pkg := range dependencies {
+		rev, err := revision(pkg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "%s %s\n", pkg, rev)
+	}
+	return os.WriteFile(pinFile, buf.Bytes(), 0644)
+}
+
+// checkDependencies verifies that every dependency is checked out at revision
+// pinned in pinFile
+func checkDependencies() error {
+	f, err := os.Open(pinFile)
+	if err != nil {
+		return fmt.Errorf("%v; pin dependency revisions with -pin first", err)
+	}
+	defer f.Close()
+	pinned := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if fields := strings.Fields(sc.Text()); len(fields) == 2 {
+			pinned[fields[0]] = fields[1]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	for _, pkg := range dependencies {
+		want, ok := pinned[pkg]
+		if !ok {
+			return fmt.Errorf("%s is not pinned in %s", pkg, pinFile)
+		}
+		rev, err := revision(pkg)
+		if err != nil {
+			return err
+		}
+		if rev != want {
+			return fmt.Errorf("%s is at %s, %s pins %s", pkg, rev, pinFile, want)
+		}
+	}
+	return nil
+}
+
+// goOutput runs go command in GOPATH mode and returns its trimmed output
+func goOutput(args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	return output(cmd)
+}
+
+func output(cmd *exec.Cmd) (string, error) {
+	cmd.Stderr = os.Stderr
+	b, err := cmd.Output()
+	return strings.TrimSpace(string(b)), err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	riskquarterfmt = "%8s\t$%.0f\n"
+	riskfamilyfmt  = "%20s\t$%.0f\t%.0f%%\n"
+	riskunusedfmt  = "%10s\t%d of %d reservations unused (%.0f%%)\n"
+)
+
+// commitment is a group of reservations with their remaining hourly charges
+type commitment struct {
+	Service string    // EC2 or RDS
+	Family  string    // instance family, i.e. m5 or db.r5
+	Count   int       // number of reserved instances
+	Hourly  float64   // hourly charges of single reserved instance, USD
+	End     time.Time // reservation end time
+}
+
+// remaining returns charges still to be paid for commitment until its end,
+// USD
+func (c commitment) remaining(now time.Time) float64 {
+	if !c.End.After(now) {
+		return 0
+	}
+	return c.Hourly * float64(c.Count) * c.End.Sub(now).Hours()
+}
+
+// reservationUsage is number of reservations of a service and how many of
+// them have no matching usage
+type reservationUsage struct {
+	Service       string
+	Total, Unused int
+}
+
+// printRisk summarizes commitment risk of reservations: remaining hourly
+// charges by quarter reservations expire in and by instance family, and how
+// many reservations have no matching usage. Upfront payments are already
+// made, so they are not counted as remaining.
+func printRisk(commitments []commitment, usage []reservationUsage, now time.Time) {
+	byQuarter := make(map[string]float64)
+	byFamily := make(map[string]float64)
+	var total float64
+	for _, c := range commitments {
+		v := c.remaining(now)
+		if v == 0 {
+			continue
+		}
+		q := fmt.Sprintf("%dQ%d", c.End.Year(), (int(c.End.Month())+2)/3)
+		byQuarter[q] += v
+		byFamily[c.Service+" "+c.Family] += v
+		total += v
+	}
+	if total > 0 {
+		fmt.Printf("\nRemaining reservation charges by expiry quarter, USD (total $%.0f):\n", total)
+		var quarters []string
+		for q := range byQuarter {
+			quarters = append(quarters, q)
+		}
+		sort.Strings(quarters)
+		for _, q := range quarters {
+			fmt.Printf(riskquarterfmt, q, byQuarter[q])
+		}
+		fmt.Println("\nRemaining reservation charges by instance family, USD:")
+		var families []string
+		for f := range byFamily {
+			families = append(families, f)
+		}
+		sort.Slice(families, func(i, j int) bool { return byFamily[families[i]] > byFamily[families[j]] })
+		for _, f := range families {
+			fmt.Printf(riskfamilyfmt, f, byFamily[f], 100*byFamily[f]/total)
+		}
+	}
+	headerPrinted := false
+	for _, u := range usage {
+		if u.Total == 0 {
+			continue
+		}
+		if !headerPrinted {
+			headerPrinted = true
+			fmt.Println("\nReservations without matching usage:")
+		}
+		fmt.Printf(riskunusedfmt, u.Service, u.Unused, u.Total, 100*float64(u.Unused)/float64(u.Total))
+	}
+}
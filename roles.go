@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/sts"
+)
+
+// roleServices lists services role can be set for with -roles
+var roleServices = []string{"autoscaling", "ce", "ec2", "ecs", "eks", "elasticache", "es", "lambda", "license-manager", "medialive", "memorydb", "monitoring", "rds", "redshift", "redshift-serverless", "s3", "sagemaker", "savingsplans"}
+
+// roleCreds holds credentials to use by service
+type roleCreds struct {
+	base  aws.CredentialsProvider
+	roles map[string]aws.CredentialsProvider // by service name
+}
+
+// newRoleCreds returns roleCreds assuming roles by service name using base
+// credentials; services without a role use base credentials directly. Roles
+// are assumed lazily, on the first request to their service.
+func newRoleCreds(base aws.CredentialsProvider, roles map[string]string, region string, client *http.Client) (*roleCreds, error) {
+	rc := &roleCreds{base: base, roles: make(map[string]aws.CredentialsProvider)}
+	byARN := make(map[string]aws.CredentialsProvider)
+	for service, arn := range roles {
+		i := sort.SearchStrings(roleServices, service)
+		if i == len(roleServices) || roleServices[i] != service {
+			return nil, fmt.Errorf("cannot set role for %q, want one of %v", service, roleServices)
+		}
+		// services sharing the same role share credentials
+		p, ok := byARN[arn]
+		if !ok {
+			p = &assumeRoleCreds{base: base, arn: arn, region: region, client: client}
+			byARN[arn] = p
+		}
+		rc.roles[service] = p
+	}
+	return rc, nil
+}
+
+// get returns credentials to use for service
+func (rc *roleCreds) get(service string) aws.CredentialsProvider {
+	if p, ok := rc.roles[service]; ok {
+		return p
+	}
+	return rc.base
+}
+
+// all returns every distinct credentials provider, base one first
+func (rc *roleCreds) all() []aws.CredentialsProvider {
+	out := []aws.CredentialsProvider{rc.base}
+	seen := make(map[aws.CredentialsProvider]bool)
+	for _, service := range roleServices {
+		if p, ok := rc.roles[service]; ok && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// assumeRoleCreds provides temporary credentials of role, refreshing them
+// before they expire
+type assumeRoleCreds struct {
+	base   aws.CredentialsProvider
+	arn    string
+	region string
+	client *http.Client
+
+	mu      sync.Mutex
+	creds   *aws.Credentials
+	expires time.Time
+}
+
+func (p *assumeRoleCreds) Credentials() (*aws.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.creds != nil && time.Until(p.expires) > 5*time.Minute {
+		return p.creds, nil
+	}
+	resp, err := sts.New(p.base, p.region, p.client).AssumeRole(&sts.AssumeRoleRequest{
+		RoleARN:         aws.String(p.arn),
+		RoleSessionName: aws.String("aws-reservations"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := resp.Credentials
+	if c == nil {
+		return nil, fmt.Errorf("no credentials returned for role %s", p.arn)
+	}
+	p.creds = &aws.Credentials{
+		AccessKeyID:     toStr(c.AccessKeyID),
+		SecretAccessKey: toStr(c.SecretAccessKey),
+		SecurityToken:   toStr(c.SessionToken),
+	}
+	p.expires = c.Expiration
+	return p.creds, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/endpoints"
+)
+
+var sagemakerfmt = "%20s\t%28s\t%d\n"
+
+// sageMakerKey groups running SageMaker instances
+type sageMakerKey struct {
+	Component string // notebook, endpoint or training
+	Class     string // instance type (i.e. ml.m5.xlarge)
+}
+
+// getSageMakerUsage returns number of SageMaker notebook, endpoint and
+// training instances running now, all of which SageMaker Savings Plans apply
+// to. Vendored aws-go has no SageMaker client, so requests are made with the
+// underlying JSON client directly.
+func getSageMakerUsage(creds aws.CredentialsProvider, region string, client *http.Client) (map[sageMakerKey]int, error) {
+	c := newSageMakerClient(creds, region, client)
+	out := make(map[sageMakerKey]int)
+	if err := getSageMakerNotebooks(c, out); err != nil {
+		return nil, err
+	}
+	if err := getSageMakerEndpoints(c, out); err != nil {
+		return nil, err
+	}
+	if err := getSageMakerTraining(c, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func getSageMakerNotebooks(c *aws.JSONClient, out map[sageMakerKey]int) error {
+	req := struct {
+		StatusEquals string
+		MaxResults   int
+		NextToken    string `json:",omitempty"`
+	}{StatusEquals: "InService", MaxResults: 100}
+	for {
+		var resp struct {
+			NotebookInstances []struct{ InstanceType string }
+			NextToken         string
+		}
+		if err := c.Do("ListNotebookInstances", "POST", "/", req, &resp); err != nil {
+			return err
+		}
+		for _, n := range resp.NotebookInstances {
+			out[sageMakerKey{Component: "notebook", Class: n.InstanceType}]++
+		}
+		if resp.NextToken == "" {
+			return nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// getSageMakerEndpoints counts instances of endpoints in service. Endpoint
+// only reports number of instances of its variants, their instance types are
+// taken from endpoint configs.
+func getSageMakerEndpoints(c *aws.JSONClient, out map[sageMakerKey]int) error {
+	req := struct {
+		StatusEquals string
+		MaxResults   int
+		NextToken    string `json:",omitempty"`
+	}{StatusEquals: "InService", MaxResults: 100}
+	for {
+		var resp struct {
+			Endpoints []struct{ EndpointName string }
+			NextToken string
+		}
+		if err := c.Do("ListEndpoints", "POST", "/", req, &resp); err != nil {
+			return err
+		}
+		for _, e := range resp.Endpoints {
+			var ep struct {
+				EndpointConfigName string
+				ProductionVariants []struct {
+					VariantName          string
+					CurrentInstanceCount int
+				}
+			}
+			if err := c.Do("DescribeEndpoint", "POST", "/", struct{ EndpointName string }{e.EndpointName}, &ep); err != nil {
+				return err
+			}
+			var cfg struct {
+				ProductionVariants []struct {
+					VariantName  string
+					InstanceType string // empty for serverless variants
+				}
+			}
+			if err := c.Do("DescribeEndpointConfig", "POST", "/", struct{ EndpointConfigName string }{ep.EndpointConfigName}, &cfg); err != nil {
+				return err
+			}
+			types := make(map[string]string)
+			for _, v := range cfg.ProductionVariants {
+				types[v.VariantName] = v.InstanceType
+			}
+			for _, v := range ep.ProductionVariants {
+				if t := types[v.VariantName]; t != "" {
+					out[sageMakerKey{Component: "endpoint", Class: t}] += v.CurrentInstanceCount
+				}
+			}
+		}
+		if resp.NextToken == "" {
+			return nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+func getSageMakerTraining(c *aws.JSONClient, out map[sageMakerKey]int) error {
+	req := struct {
+		StatusEquals string
+		MaxResults   int
+		NextToken    string `json:",omitempty"`
+	}{StatusEquals: "InProgress", MaxResults: 100}
+	for {
+		var resp struct {
+			TrainingJobSummaries []struct{ TrainingJobName string }
+			NextToken            string
+		}
+		if err := c.Do("ListTrainingJobs", "POST", "/", req, &resp); err != nil {
+			return err
+		}
+		for _, j := range resp.TrainingJobSummaries {
+			var job struct {
+				ResourceConfig struct {
+					InstanceType  string
+					InstanceCount int
+				}
+			}
+			if err := c.Do("DescribeTrainingJob", "POST", "/", struct{ TrainingJobName string }{j.TrainingJobName}, &job); err != nil {
+				return err
+			}
+			if rc := job.ResourceConfig; rc.InstanceType != "" {
+				out[sageMakerKey{Component: "training", Class: rc.InstanceType}] += rc.InstanceCount
+			}
+		}
+		if resp.NextToken == "" {
+			return nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+func newSageMakerClient(creds aws.CredentialsProvider, region string, client *http.Client) *aws.JSONClient {
+	endpoint, _, region := endpoints.Lookup("api.sagemaker", region)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.JSONClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     "sagemaker", // differs from endpoint name
+			Region:      region,
+		},
+		Client:       client,
+		Endpoint:     endpoint,
+		TargetPrefix: "SageMaker",
+		JSONVersion:  "1.1",
+	}
+}
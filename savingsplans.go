@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+var (
+	spfmt         = "%20s\t%12s\t%10s/h\t%s\n"
+	spcoveragefmt = "%30s\t%10.2f covered\t%10.2f on-demand\n"
+	sputilfmt     = "%30s\t%10.2f used\t%10.2f unused\n"
+)
+
+// Savings Plans and Cost Explorer are global services served from us-east-1;
+// vendored aws-go has no clients for them nor their endpoints.
+const (
+	savingsPlansEndpoint = "https://savingsplans.amazonaws.com"
+	costExplorerEndpoint = "https://ce.us-east-1.amazonaws.com"
+)
+
+// savingsPlan is an item of DescribeSavingsPlans response
+type savingsPlan struct {
+	ID         string `json:"savingsPlanId"`
+	Type       string `json:"savingsPlanType"` // Compute, EC2Instance or SageMaker
+	Commitment string `json:"commitment"`      // hourly commitment in USD
+	Family     string `json:"ec2InstanceFamily"`
+	Region     string `json:"region"`
+	State      string `json:"state"`
+	End        string `json:"end"`
+}
+
+// getSavingsPlans returns active Savings Plans of the account
+func getSavingsPlans(creds aws.CredentialsProvider, client *http.Client) ([]savingsPlan, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &aws.RestClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     "savingsplans",
+			Region:      "us-east-1",
+		},
+		Client:   client,
+		Endpoint: savingsPlansEndpoint,
+	}
+	type request struct {
+		States    []string `json:"states"`
+		NextToken string   `json:"nextToken,omitempty"`
+	}
+	req := request{States: []string{"active"}}
+	var out []savingsPlan
+	for {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		httpReq, err := http.NewRequest("POST", c.Endpoint+"/DescribeSavingsPlans", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpResp, err := c.Do(httpReq)
+		if err != nil {
+			return nil, err
+		}
+		var resp struct {
+			SavingsPlans []savingsPlan `json:"savingsPlans"`
+			NextToken    string        `json:"nextToken"`
+		}
+		err = json.NewDecoder(httpResp.Body).Decode(&resp)
+		httpResp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, resp.SavingsPlans...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// getSavingsPlansCoverage returns share of EC2 usage not covered by
+// reservations that Savings Plans covered during the last full day in
+// region, by instance family. Cost Explorer reports coverage in spend, and
+// as instances of the same family cost roughly the same per unit of size,
+// share of spend is used as share of instances.
+func getSavingsPlansCoverage(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]float64, error) {
+	cov, err := getSpendCoverage(creds, client, "INSTANCE_FAMILY",
+		ceDimension{"REGION", []string{region}},
+		ceDimension{"SERVICE", []string{"Amazon Elastic Compute Cloud - Compute"}})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]float64)
+	for family, c := range cov {
+		if total := c.Covered + c.OnDemand; total > 0 {
+			out[family] = c.Covered / total
+		}
+	}
+	return out, nil
+}
+
+// spServices lists Cost Explorer names of services, other than EC2, whose
+// usage Savings Plans can cover
+var spServices = []string{
+	"Amazon Elastic Container Service",
+	"Amazon Elastic Container Service for Kubernetes",
+	"Amazon SageMaker",
+	"AWS Lambda",
+}
+
+// getServiceCoverage returns Savings Plans coverage of spend during the last
+// full day in region by service, for services in spServices
+func getServiceCoverage(creds aws.CredentialsProvider, region string, client *http.Client) (map[string]spendCoverage, error) {
+	return getSpendCoverage(creds, client, "SERVICE",
+		ceDimension{"REGION", []string{region}},
+		ceDimension{"SERVICE", spServices})
+}
+
+// spendCoverage describes spend eligible for Savings Plans, in USD
+type spendCoverage struct {
+	Covered  float64 // spend covered by Savings Plans
+	OnDemand float64 // spend charged at on-demand rates
+}
+
+// ceDimension is a Cost Explorer filter on dimension values
+type ceDimension struct {
+	Key    string   `json:"Key"`
+	Values []string `json:"Values"`
+}
+
+// getSpendCoverage calls Cost Explorer GetSavingsPlansCoverage for the last
+// full day, with all filters applied, and returns coverage grouped by
+// dimension groupBy.
+func getSpendCoverage(creds aws.CredentialsProvider, client *http.Client, groupBy string, filters ...ceDimension) (map[string]spendCoverage, error) {
+	type expression struct {
+		Dimensions ceDimension `json:"Dimensions"`
+	}
+	type group struct {
+		Type string `json:"Type"`
+		Key  string `json:"Key"`
+	}
+	type request struct {
+		TimePeriod  map[string]string `json:"TimePeriod"`
+		Granularity string            `json:"Granularity"`
+		GroupBy     []group           `json:"GroupBy"`
+		Filter      struct {
+			And []expression `json:"And"`
+		} `json:"Filter"`
+		NextToken string `json:"NextToken,omitempty"`
+	}
+	req := request{
+		TimePeriod:  lastFullDay(),
+		Granularity: "DAILY",
+		GroupBy:     []group{{"DIMENSION", groupBy}},
+	}
+	for _, f := range filters {
+		req.Filter.And = append(req.Filter.And, expression{f})
+	}
+	c := newCostExplorerClient(creds, client)
+	out := make(map[string]spendCoverage)
+	for {
+		var resp struct {
+			Coverages []struct {
+				Attributes map[string]string `json:"Attributes"`
+				Coverage   struct {
+					Covered  string `json:"SpendCoveredBySavingsPlans"`
+					OnDemand string `json:"OnDemandCost"`
+				} `json:"Coverage"`
+			} `json:"SavingsPlansCoverages"`
+			NextToken string `json:"NextToken"`
+		}
+		if err := c.Do("GetSavingsPlansCoverage", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, cv := range resp.Coverages {
+			k := spAttribute(cv.Attributes, groupBy)
+			sc := out[k]
+			v, _ := strconv.ParseFloat(cv.Coverage.Covered, 64)
+			sc.Covered += v
+			v, _ = strconv.ParseFloat(cv.Coverage.OnDemand, 64)
+			sc.OnDemand += v
+			out[k] = sc
+		}
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// spendUtilization describes how much of Savings Plans commitment was used,
+// in USD
+type spendUtilization struct {
+	Used   float64
+	Unused float64
+}
+
+// getSavingsPlansUtilization returns utilization of Savings Plans of the
+// given type (COMPUTE_SP, EC2_INSTANCE_SP or SAGEMAKER_SP) during the last
+// full day
+func getSavingsPlansUtilization(creds aws.CredentialsProvider, client *http.Client, planType string) (spendUtilization, error) {
+	req := struct {
+		TimePeriod map[string]string `json:"TimePeriod"`
+		Filter     struct {
+			Dimensions ceDimension `json:"Dimensions"`
+		} `json:"Filter"`
+	}{TimePeriod: lastFullDay()}
+	req.Filter.Dimensions = ceDimension{"SAVINGS_PLANS_TYPE", []string{planType}}
+	var resp struct {
+		Total struct {
+			Utilization struct {
+				Used   string `json:"UsedCommitment"`
+				Unused string `json:"UnusedCommitment"`
+			} `json:"Utilization"`
+		} `json:"Total"`
+	}
+	var out spendUtilization
+	if err := newCostExplorerClient(creds, client).Do("GetSavingsPlansUtilization", "POST", "/", req, &resp); err != nil {
+		// Cost Explorer reports no plans of the type as an error
+		if e, ok := err.(aws.APIError); ok && strings.HasSuffix(e.Type, "DataUnavailableException") {
+			return out, nil
+		}
+		return out, err
+	}
+	out.Used, _ = strconv.ParseFloat(resp.Total.Utilization.Used, 64)
+	out.Unused, _ = strconv.ParseFloat(resp.Total.Utilization.Unused, 64)
+	return out, nil
+}
+
+func newCostExplorerClient(creds aws.CredentialsProvider, client *http.Client) *aws.JSONClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &aws.JSONClient{
+		Context: aws.Context{
+			Credentials: creds,
+			Service:     "ce",
+			Region:      "us-east-1",
+		},
+		Client:       client,
+		Endpoint:     costExplorerEndpoint,
+		TargetPrefix: "AWSInsightsIndexService",
+		JSONVersion:  "1.1",
+	}
+}
+
+// lastFullDay returns Cost Explorer time period of the last full day in UTC
+func lastFullDay() map[string]string {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	return map[string]string{
+		"Start": today.AddDate(0, 0, -1).Format(dateLayout),
+		"End":   today.Format(dateLayout),
+	}
+}
+
+// spAttribute returns value of Cost Explorer group attribute, matching its
+// key loosely, as response keys are spelled differently from request
+// dimensions (i.e. instanceFamily for INSTANCE_FAMILY).
+func spAttribute(attrs map[string]string, dimension string) string {
+	want := strings.Replace(dimension, "_", "", -1)
+	for k, v := range attrs {
+		if strings.EqualFold(strings.Replace(k, "_", "", -1), want) {
+			return v
+		}
+	}
+	return ""
+}
+
+// instanceFamily returns family of instance class (i.e. m5 for m5.large)
+func instanceFamily(class string) string {
+	return strings.SplitN(class, ".", 2)[0]
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// runScans runs fetch functions using at most workers goroutines at once.
+// Every function is run even if some of them fail; all errors are returned
+// together.
+func runScans(workers int, fns ...func() error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs scanError
+	)
+	sem := make(chan struct{}, workers)
+	for _, fn := range fns {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(fn func() error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(fn)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// scanError is returned by runScans when some of fetch functions failed
+type scanError []error
+
+func (e scanError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return "multiple errors:\n  " + strings.Join(s, "\n  ")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+var scheduledfmt = "%20s\t%15s\t%d\t%-30s\tends %s\n"
+
+// scheduledInstance is an item of DescribeScheduledInstances response
+type scheduledInstance struct {
+	ID        string    `xml:"scheduledInstanceId"`
+	Class     string    `xml:"instanceType"`
+	Zone      string    `xml:"availabilityZone"`
+	Count     int       `xml:"instanceCount"`
+	Hours     int       `xml:"slotDurationInHours"`
+	Frequency string    `xml:"recurrence>frequency"` // Daily, Weekly or Monthly
+	Interval  int       `xml:"recurrence>interval"`
+	Days      []int     `xml:"recurrence>occurrenceDaySet>item"`
+	End       time.Time `xml:"termEndDate"`
+}
+
+// getScheduledInstances returns Scheduled Reserved Instances. Vendored ec2
+// package predates them, so requests are made with the underlying ec2 client
+// directly.
+func getScheduledInstances(creds aws.CredentialsProvider, region string, client *http.Client) ([]scheduledInstance, error) {
+	c := newEC2Client(creds, region, client)
+	var out []scheduledInstance
+	req := &describePage{MaxResults: aws.Integer(300)}
+	for {
+		var resp struct {
+			Instances []scheduledInstance `xml:"scheduledInstanceSet>item"`
+			NextToken string              `xml:"nextToken"`
+		}
+		if err := c.Do("DescribeScheduledInstances", "POST", "/", req, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Instances...)
+		if resp.NextToken == "" {
+			return out, nil
+		}
+		req.NextToken = aws.String(resp.NextToken)
+	}
+}
+
+// schedule describes recurrence of scheduled instance, i.e. "8h every 2
+// weeks on 1,5"
+func (s scheduledInstance) schedule() string {
+	period := map[string]string{"Daily": "day", "Weekly": "week", "Monthly": "month"}[s.Frequency]
+	if period == "" {
+		period = s.Frequency
+	}
+	out := fmt.Sprintf("%dh every %s", s.Hours, period)
+	if s.Interval > 1 {
+		out = fmt.Sprintf("%dh every %d %ss", s.Hours, s.Interval, period)
+	}
+	if len(s.Days) == 0 {
+		return out
+	}
+	days := make([]string, len(s.Days))
+	for i, d := range s.Days {
+		days[i] = fmt.Sprint(d)
+	}
+	return out + " on " + strings.Join(days, ",")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+	"github.com/stripe/aws-go/gen/cloudwatch"
+	"github.com/stripe/aws-go/gen/ec2"
+	elasticcache "github.com/stripe/aws-go/gen/elasticache"
+	"github.com/stripe/aws-go/gen/rds"
+	"github.com/stripe/aws-go/gen/redshift"
+)
+
+var selftestfmt = "%-45s\t%s\n"
+
+// maxClockSkew is the largest difference between local and AWS clock for
+// which signed requests are still accepted
+const maxClockSkew = 5 * time.Minute
+
+// selftest checks that credentials work, that every API call this tool makes
+// is permitted and reachable, and that local clock is in sync with AWS. It
+// prints a checklist and reports whether all checks passed.
+func selftest(rc *roleCreds, region string, client *http.Client) bool {
+	ct := &clockTransport{next: http.DefaultTransport}
+	if client != nil && client.Transport != nil {
+		ct.next = client.Transport
+	}
+	client = &http.Client{Transport: ct}
+	creds := rc.base
+	ec2c := ec2.New(rc.get("ec2"), region, client)
+	rdsc := rds.New(rc.get("rds"), region, client)
+	ecc := elasticcache.New(rc.get("elasticache"), region, client)
+	rsc := redshift.New(rc.get("redshift"), region, client)
+	ec2raw := newEC2Client(rc.get("ec2"), region, client)
+	checks := []struct {
+		name string
+		fn   func() error
+	}{
+		{"credentials", func() error {
+			_, err := creds.Credentials()
+			return err
+		}},
+		{"sts:GetCallerIdentity", func() error {
+			_, err := getCallerIdentity(creds, region, client)
+			return err
+		}},
+		{"ec2:DescribeInstances", func() error {
+			_, err := ec2c.DescribeInstances(&ec2.DescribeInstancesRequest{DryRun: aws.True()})
+			return dryRunErr(err)
+		}},
+		{"ec2:DescribeReservedInstances", func() error {
+			_, err := ec2c.DescribeReservedInstances(&ec2.DescribeReservedInstancesRequest{DryRun: aws.True()})
+			return dryRunErr(err)
+		}},
+		{"ec2:DescribeReservedInstancesOfferings", func() error {
+			_, err := ec2c.DescribeReservedInstancesOfferings(&ec2.DescribeReservedInstancesOfferingsRequest{DryRun: aws.True()})
+			return dryRunErr(err)
+		}},
+		{"rds:DescribeDBInstances", func() error {
+			_, err := rdsc.DescribeDBInstances(&rds.DescribeDBInstancesMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"rds:DescribeDBClusters", func() error {
+			_, err := getAuroraClusters(rc.get("rds"), region, client)
+			return err
+		}},
+		{"rds:DescribeReservedDBInstances", func() error {
+			_, err := rdsc.DescribeReservedDBInstances(&rds.DescribeReservedDBInstancesMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"rds:DescribeReservedDBInstancesOfferings", func() error {
+			_, err := rdsc.DescribeReservedDBInstancesOfferings(&rds.DescribeReservedDBInstancesOfferingsMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"elasticache:DescribeCacheClusters", func() error {
+			_, err := ecc.DescribeCacheClusters(&elasticcache.DescribeCacheClustersMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"elasticache:DescribeReplicationGroups", func() error {
+			_, err := ecc.DescribeReplicationGroups(&elasticcache.DescribeReplicationGroupsMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"elasticache:DescribeReservedCacheNodes", func() error {
+			_, err := ecc.DescribeReservedCacheNodes(&elasticcache.DescribeReservedCacheNodesMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"elasticache:DescribeServerlessCaches", func() error {
+			_, err := getServerlessCaches(rc.get("elasticache"), region, client)
+			return err
+		}},
+		{"redshift:DescribeClusters", func() error {
+			_, err := rsc.DescribeClusters(&redshift.DescribeClustersMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"redshift:DescribeReservedNodes", func() error {
+			_, err := rsc.DescribeReservedNodes(&redshift.DescribeReservedNodesMessage{MaxRecords: aws.Integer(20)})
+			return err
+		}},
+		{"redshift-serverless:ListWorkgroups", func() error {
+			_, err := getServerlessWorkgroups(rc.get("redshift-serverless"), rc.get("monitoring"), region, client)
+			return err
+		}},
+		{"ec2:DescribeHosts", func() error {
+			return ec2raw.Do("DescribeHosts", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ec2:DescribeHostReservations", func() error {
+			return ec2raw.Do("DescribeHostReservations", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ec2:DescribeSubnets", func() error {
+			return ec2raw.Do("DescribeSubnets", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ec2:DescribeScheduledInstances", func() error {
+			return ec2raw.Do("DescribeScheduledInstances", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ec2:DescribeCapacityReservations", func() error {
+			return ec2raw.Do("DescribeCapacityReservations", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ec2:DescribeCapacityReservationFleets", func() error {
+			return ec2raw.Do("DescribeCapacityReservationFleets", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ec2:DescribeInstanceTypes", func() error {
+			return ec2raw.Do("DescribeInstanceTypes", "POST", "/", &describePage{MaxResults: aws.Integer(5)}, nil)
+		}},
+		{"ecs:ListClusters", func() error {
+			return newECSClient(rc.get("ecs"), region, client).Do("ListClusters", "POST", "/", struct{}{}, nil)
+		}},
+		{"lambda:ListFunctions", func() error {
+			_, err := getLambdaMemory(rc.get("lambda"), region, client)
+			return err
+		}},
+		{"license-manager:ListLicenseConfigurations", func() error {
+			return newLicenseManagerClient(rc.get("license-manager"), region, client).Do("ListLicenseConfigurations", "POST", "/", struct{ MaxResults int }{5}, nil)
+		}},
+		{"es:ListDomainNames", func() error {
+			var resp struct{}
+			return searchDo(newSearchClient(rc.get("es"), region, client), "GET", "/2021-01-01/domain", nil, nil, &resp)
+		}},
+		{"es:DescribeReservedInstances", func() error {
+			var resp struct{}
+			return searchDo(newSearchClient(rc.get("es"), region, client), "GET", "/2021-01-01/opensearch/reservedInstances", nil, nil, &resp)
+		}},
+		{"memorydb:DescribeClusters", func() error {
+			return newMemoryDBClient(rc.get("memorydb"), region, client).Do("DescribeClusters", "POST", "/", struct{ MaxResults int }{5}, nil)
+		}},
+		{"memorydb:DescribeReservedNodes", func() error {
+			return newMemoryDBClient(rc.get("memorydb"), region, client).Do("DescribeReservedNodes", "POST", "/", struct{ MaxResults int }{5}, nil)
+		}},
+		{"medialive:ListChannels, ListReservations", func() error {
+			_, _, err := getMediaLive(rc.get("medialive"), region, client)
+			return err
+		}},
+		{"autoscaling:DescribeAutoScalingGroups", func() error {
+			_, err := getDesiredCapacity(rc.get("autoscaling"), region, client)
+			return err
+		}},
+		{"cloudwatch:GetMetricStatistics", func() error {
+			_, err := cloudwatch.New(rc.get("monitoring"), region, client).GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+				Namespace:  aws.String("AWS/Lambda"),
+				MetricName: aws.String("Duration"),
+				StartTime:  time.Now().Add(-time.Hour),
+				EndTime:    time.Now(),
+				Period:     aws.Integer(3600),
+				Statistics: []string{"Sum"},
+			})
+			return err
+		}},
+		// ce:GetSavingsPlansCoverage is not checked, as every call is billed
+		{"savingsplans:DescribeSavingsPlans", func() error {
+			_, err := getSavingsPlans(rc.get("savingsplans"), client)
+			return err
+		}},
+		{"eks:ListClusters", func() error {
+			_, err := eksList(newEKSClient(rc.get("eks"), region, client), "/clusters", "clusters")
+			return err
+		}},
+		{"sagemaker:ListNotebookInstances", func() error {
+			return newSageMakerClient(rc.get("sagemaker"), region, client).Do("ListNotebookInstances", "POST", "/", struct{ MaxResults int }{5}, nil)
+		}},
+		{"sagemaker:ListEndpoints", func() error {
+			return newSageMakerClient(rc.get("sagemaker"), region, client).Do("ListEndpoints", "POST", "/", struct{ MaxResults int }{5}, nil)
+		}},
+		{"sagemaker:ListTrainingJobs", func() error {
+			return newSageMakerClient(rc.get("sagemaker"), region, client).Do("ListTrainingJobs", "POST", "/", struct{ MaxResults int }{5}, nil)
+		}},
+	}
+	ok := true
+	for _, service := range roleServices {
+		p, isSet := rc.roles[service]
+		if !isSet {
+			continue
+		}
+		name := "sts:AssumeRole for " + service
+		if _, err := p.Credentials(); err != nil {
+			ok = false
+			fmt.Printf(selftestfmt, name, "FAIL: "+describeErr(err))
+			continue
+		}
+		fmt.Printf(selftestfmt, name, "ok")
+	}
+	for _, c := range checks {
+		if err := c.fn(); err != nil {
+			ok = false
+			fmt.Printf(selftestfmt, c.name, "FAIL: "+describeErr(err))
+			continue
+		}
+		fmt.Printf(selftestfmt, c.name, "ok")
+	}
+	switch skew, known := ct.skew(); {
+	case !known:
+		ok = false
+		fmt.Printf(selftestfmt, "clock skew", "FAIL: no response from AWS to compare with")
+	case skew > maxClockSkew || skew < -maxClockSkew:
+		ok = false
+		fmt.Printf(selftestfmt, "clock skew", "FAIL: local clock is off by "+skew.String())
+	default:
+		fmt.Printf(selftestfmt, "clock skew", "ok ("+skew.String()+")")
+	}
+	return ok
+}
+
+// dryRunErr returns nil for errors reporting that DryRun request would have
+// succeeded
+func dryRunErr(err error) error {
+	if e, ok := err.(aws.APIError); ok && e.Code == "DryRunOperation" {
+		return nil
+	}
+	return err
+}
+
+// describeErr returns error text, including error code for AWS API errors
+// which otherwise only carry a message
+func describeErr(err error) string {
+	if e, ok := err.(aws.APIError); ok && e.Code != "" {
+		return e.Code + ": " + e.Message
+	}
+	return err.Error()
+}
+
+// clockTransport remembers the difference between local clock and Date
+// header of the last response received
+type clockTransport struct {
+	next http.RoundTripper
+
+	mu    sync.Mutex
+	delta time.Duration
+	known bool
+}
+
+func (t *clockTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if d, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		t.mu.Lock()
+		t.delta, t.known = time.Now().Sub(d).Truncate(time.Second), true
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// skew returns how far local clock is ahead of AWS clock
+func (t *clockTransport) skew() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.delta, t.known
+}
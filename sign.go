@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadSigningKey reads Ed25519 private key from PEM file in PKCS #8 form, as
+// written by "openssl genpkey -algorithm ed25519"
+func loadSigningKey(name string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", name)
+	}
+	return k, nil
+}
+
+// loadVerifyingKey reads Ed25519 public key from PEM file in PKIX form, as
+// written by "openssl pkey -pubout"
+func loadVerifyingKey(name string) (ed25519.PublicKey, error) {
+	block, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", name)
+	}
+	return k, nil
+}
+
+func readPEM(name string) (*pem.Block, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", name)
+	}
+	return block, nil
+}
+
+// sign returns detached signature of data: its SHA-256 digest and Ed25519
+// signature of the digest, one per line
+func sign(data []byte, key ed25519.PrivateKey) []byte {
+	sum := sha256.Sum256(data)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "sha256 %x\n", sum)
+	fmt.Fprintf(&out, "ed25519 %s\n", base64.StdEncoding.EncodeToString(ed25519.Sign(key, sum[:])))
+	return out.Bytes()
+}
+
+// verify checks detached signature sig of data made by sign
+func verify(data, sig []byte, key ed25519.PublicKey) error {
+	fields := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(sig))
+	for sc.Scan() {
+		if f := strings.Fields(sc.Text()); len(f) == 2 {
+			fields[f[0]] = f[1]
+		}
+	}
+	digest, err := hex.DecodeString(fields["sha256"])
+	if err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("malformed signature: bad sha256 digest")
+	}
+	signature, err := base64.StdEncoding.DecodeString(fields["ed25519"])
+	if err != nil {
+		return fmt.Errorf("malformed signature: bad ed25519 signature")
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], digest) {
+		return fmt.Errorf("digest mismatch, data was modified")
+	}
+	if !ed25519.Verify(key, digest, signature) {
+		return fmt.Errorf("signature does not match the key")
+	}
+	return nil
+}
+
+// verifyFile checks signature of file with public key from keyFile; signature
+// is read from sigFile, or file with .sig suffix if sigFile is empty
+func verifyFile(keyFile, file, sigFile string) error {
+	key, err := loadVerifyingKey(keyFile)
+	if err != nil {
+		return err
+	}
+	if sigFile == "" {
+		sigFile = file + ".sig"
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return err
+	}
+	return verify(data, sig, key)
+}
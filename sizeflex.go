@@ -0,0 +1,291 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	flexfmt    = "%20s\t%5s\t%.2f %s%s%s\n"
+	rdsflexfmt = "%20s\t%10s\t%9s\t%.2f %s\n"
+)
+
+// normalizationFactor returns number of normalization units AWS assigns to
+// instance size when applying size flexible reservations (i.e. 4 for
+// m5.large or db.m5.large, 16 for m5.2xlarge), or zero if size is not known
+func normalizationFactor(class string) float64 {
+	class = strings.TrimPrefix(class, "db.")
+	size := strings.TrimPrefix(class, instanceFamily(class)+".")
+	switch size {
+	case "nano":
+		return 0.25
+	case "micro":
+		return 0.5
+	case "small":
+		return 1
+	case "medium":
+		return 2
+	case "large":
+		return 4
+	case "xlarge":
+		return 8
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(size, "xlarge")); err == nil && n > 0 {
+		return 8 * float64(n)
+	}
+	return 0
+}
+
+// flexSlot is a single class within group of classes of the same family
+// size flexible reservations apply to
+type flexSlot struct {
+	Factor float64 // normalization factor of class
+	Net    int     // instances less reservations, as in ei
+	Run    int     // instances which may be covered by reservation of other size
+	Res    int     // reservations which may cover instances of other size
+}
+
+// settleSlots lets unused size flexible reservations of a group cover
+// on-demand instances of other sizes, comparing them in normalization units,
+// and adjusts Net of slots accordingly. Slots must be sorted by Factor,
+// larger first, so that fewer of them are left partially covered or
+// partially unused. Units left after covering whole instances are returned
+// as fraction of slot i: AWS applies them to part of a larger on-demand
+// instance if there's one (covered is true), otherwise that part of
+// reservation is unused. Fraction is zero if nothing is left.
+func settleSlots(slots []flexSlot) (i int, fraction float64, covered bool) {
+	unused := make([]int, len(slots))
+	var units float64
+	for j := range slots {
+		n := minInt(-slots[j].Net, slots[j].Res)
+		if n < 1 {
+			continue
+		}
+		unused[j] = n
+		units += float64(n) * slots[j].Factor
+		slots[j].Net += n
+	}
+	if units == 0 {
+		return 0, 0, false
+	}
+	for j := range slots {
+		f := slots[j].Factor
+		n := minInt(minInt(slots[j].Net, slots[j].Run), int(math.Floor(units/f)))
+		if n < 1 {
+			continue
+		}
+		slots[j].Net -= n
+		units -= float64(n) * f
+	}
+	if units == 0 {
+		return 0, 0, false
+	}
+	// units left cover part of a larger on-demand instance, if there's one
+	for j := range slots {
+		if minInt(slots[j].Net, slots[j].Run) > 0 {
+			return j, units / slots[j].Factor, true
+		}
+	}
+	// otherwise they're reported back as unused reservations, whole ones
+	// first
+	for j := range slots {
+		if unused[j] == 0 {
+			continue
+		}
+		f := slots[j].Factor
+		n := minInt(unused[j], int(math.Floor(units/f)))
+		slots[j].Net -= n
+		units -= float64(n) * f
+		if n < unused[j] {
+			i = j
+		}
+	}
+	if units == 0 {
+		return 0, 0, false
+	}
+	return i, units / slots[i].Factor, false
+}
+
+// flexLeftover is what's left of size flexible EC2 reservations after they
+// covered as many whole instances as possible
+type flexLeftover struct {
+	ec2Inst
+	Fraction float64 // fraction of Class instance
+	Covered  bool    // whether fraction of on-demand instance is covered, rather than fraction of reservation is unused
+}
+
+// settleSizeFlexible lets unused size flexible EC2 reservations cover
+// on-demand instances of other sizes of the same family after reservations
+// were matched by exact class. Only instances counted in flexRun and
+// reservations counted in flexRes take part, as size flexibility only applies
+// to regional Linux/UNIX reservations with default tenancy.
+func settleSizeFlexible(ei, flexRun, flexRes map[ec2Inst]int) []flexLeftover {
+	groups := make(map[ec2Inst][]ec2Inst)
+	for k := range ei {
+		if normalizationFactor(k.Class) == 0 {
+			continue
+		}
+		base := k
+		base.Class = instanceFamily(k.Class)
+		base.Tag = "" // AWS billing does not take tags into account
+		groups[base] = append(groups[base], k)
+	}
+	var out []flexLeftover
+	for _, keys := range groups {
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := normalizationFactor(keys[i].Class), normalizationFactor(keys[j].Class)
+			if a != b {
+				return a > b
+			}
+			return keys[i].Tag < keys[j].Tag
+		})
+		slots := make([]flexSlot, len(keys))
+		for i, k := range keys {
+			slots[i] = flexSlot{Factor: normalizationFactor(k.Class), Net: ei[k], Run: flexRun[k], Res: flexRes[k]}
+		}
+		i, fraction, covered := settleSlots(slots)
+		for i, k := range keys {
+			ei[k] = slots[i].Net
+		}
+		if fraction > 0 {
+			out = append(out, flexLeftover{ec2Inst: keys[i], Fraction: fraction, Covered: covered})
+		}
+	}
+	return out
+}
+
+// rdsFlexLeftover is what's left of size flexible RDS reservations after
+// they covered as many whole instances as possible
+type rdsFlexLeftover struct {
+	rdsInst
+	Fraction float64 // fraction of Class instance
+	Covered  bool    // whether fraction of on-demand instance is covered, rather than fraction of reservation is unused
+}
+
+// rdsSizeFlexible reports whether reservations for instances of k apply to
+// any size of their family: they do for open source engines, Aurora and
+// Oracle BYOL, but not for license included ones.
+func rdsSizeFlexible(k rdsInst) bool {
+	switch k.Product {
+	case "mysql", "mariadb", "postgresql", "aurora-mysql", "aurora-postgresql":
+		return true
+	}
+	return strings.HasPrefix(k.Product, "oracle-") && k.LicenseModel == "byol"
+}
+
+// settleRDSSizeFlexible lets unused size flexible RDS reservations cover
+// on-demand instances of other sizes of the same family, engine and
+// deployment after reservations were matched by exact class. If multiAZ is
+// set, deployments are mixed too, as Multi-AZ instance counts as two
+// Single-AZ ones; this also applies to reservations which are not size
+// flexible, but only within their class.
+func settleRDSSizeFlexible(ri map[rdsInst]int, multiAZ bool) []rdsFlexLeftover {
+	groups := make(map[rdsInst][]rdsInst)
+	for k := range ri {
+		if normalizationFactor(k.Class) == 0 {
+			continue
+		}
+		base := k
+		switch {
+		case rdsSizeFlexible(k):
+			base.Class = rdsInstanceFamily(k.Class)
+		case !multiAZ:
+			continue
+		}
+		if multiAZ {
+			base.MultiAZ = false
+		}
+		groups[base] = append(groups[base], k)
+	}
+	factor := func(k rdsInst) float64 {
+		if k.MultiAZ {
+			return 2 * normalizationFactor(k.Class)
+		}
+		return normalizationFactor(k.Class)
+	}
+	var out []rdsFlexLeftover
+	for _, keys := range groups {
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := factor(keys[i]), factor(keys[j])
+			if a != b {
+				return a > b
+			}
+			return keys[i].MultiAZ && !keys[j].MultiAZ
+		})
+		slots := make([]flexSlot, len(keys))
+		for i, k := range keys {
+			v := ri[k]
+			slots[i] = flexSlot{Factor: factor(k), Net: v}
+			if v > 0 {
+				slots[i].Run = v
+			} else {
+				slots[i].Res = -v
+			}
+		}
+		i, fraction, covered := settleSlots(slots)
+		for i, k := range keys {
+			ri[k] = slots[i].Net
+		}
+		if fraction > 0 {
+			out = append(out, rdsFlexLeftover{rdsInst: keys[i], Fraction: fraction, Covered: covered})
+		}
+	}
+	return out
+}
+
+// rdsInstanceFamily returns RDS instance family of class, i.e. db.r5 for
+// db.r5.2xlarge
+func rdsInstanceFamily(class string) string {
+	return "db." + instanceFamily(strings.TrimPrefix(class, "db."))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// smallestClass returns smallest class of family offered in region according
+// to types, or empty string if there's none
+func smallestClass(types map[string]instanceType, family string) string {
+	var out string
+	for name := range types {
+		f := normalizationFactor(name)
+		if f == 0 || instanceFamily(name) != family {
+			continue
+		}
+		if o := normalizationFactor(out); out == "" || f < o || f == o && name < out {
+			out = name
+		}
+	}
+	return out
+}
+
+// stringFlexSuggestion suggests how many instances of the smallest size of
+// family unused fraction of reservation could still cover, as an extra tab
+// separated column, or returns empty string if it's too small for any
+func stringFlexSuggestion(types map[string]instanceType, l flexLeftover) string {
+	if l.Covered {
+		return ""
+	}
+	class := smallestClass(types, instanceFamily(l.Class))
+	if class == "" {
+		return ""
+	}
+	n := int(math.Floor(l.Fraction*normalizationFactor(l.Class)/normalizationFactor(class) + 1e-9))
+	if n < 1 {
+		return ""
+	}
+	return "\tenough for " + strconv.Itoa(n) + " " + class
+}
+
+// stringLeftover describes what fraction of leftover stands for
+func stringLeftover(covered bool) string {
+	if covered {
+		return "of instance covered"
+	}
+	return "of reservation unused"
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSettleSlots(t *testing.T) {
+	tests := []struct {
+		name     string
+		slots    []flexSlot
+		want     []int // Net of slots after settling
+		i        int
+		fraction float64
+		covered  bool
+	}{
+		{
+			name: "large reservation covers several small instances",
+			slots: []flexSlot{
+				{Factor: 8, Net: -1, Res: 1},
+				{Factor: 4, Net: 2, Run: 2},
+			},
+			want: []int{0, 0},
+		},
+		{
+			name: "large reservation covers small instances of several sizes",
+			slots: []flexSlot{
+				{Factor: 16, Net: -1, Res: 1},
+				{Factor: 8, Net: 1, Run: 1},
+				{Factor: 4, Net: 1, Run: 1},
+				{Factor: 2, Net: 2, Run: 2},
+			},
+			want: []int{0, 0, 0, 0},
+		},
+		{
+			name: "small reservation partially covers large instance",
+			slots: []flexSlot{
+				{Factor: 8, Net: 1, Run: 1},
+				{Factor: 4, Net: -1, Res: 1},
+			},
+			want:     []int{1, 0},
+			i:        0,
+			fraction: 0.5,
+			covered:  true,
+		},
+		{
+			name: "leftover fraction of large reservation is unused",
+			slots: []flexSlot{
+				{Factor: 8, Net: -1, Res: 1},
+				{Factor: 4, Net: 1, Run: 1},
+			},
+			want:     []int{0, 0},
+			i:        0,
+			fraction: 0.5,
+		},
+		{
+			name: "whole unused reservations are reported back",
+			slots: []flexSlot{
+				{Factor: 8, Net: -2, Res: 2},
+				{Factor: 4, Net: 1, Run: 1},
+			},
+			want:     []int{-1, 0},
+			i:        0,
+			fraction: 0.5,
+		},
+		{
+			name: "instances not open to other sizes stay on-demand",
+			slots: []flexSlot{
+				{Factor: 8, Net: -1, Res: 1},
+				{Factor: 4, Net: 2},
+			},
+			want: []int{-1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, fraction, covered := settleSlots(tt.slots)
+			got := make([]int, len(tt.slots))
+			for j, s := range tt.slots {
+				got[j] = s.Net
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Net = %v, want %v", got, tt.want)
+			}
+			if fraction != tt.fraction || covered != tt.covered || fraction != 0 && i != tt.i {
+				t.Errorf("got leftover %.2f of slot %d (covered: %v), want %.2f of slot %d (covered: %v)",
+					fraction, i, covered, tt.fraction, tt.i, tt.covered)
+			}
+		})
+	}
+}
+
+func TestSettleSizeFlexible(t *testing.T) {
+	var (
+		large    = ec2Inst{Class: "m5.large", VPC: true}
+		xlarge   = ec2Inst{Class: "m5.xlarge", VPC: true}
+		xlarge2  = ec2Inst{Class: "m5.2xlarge", VPC: true}
+		winLarge = ec2Inst{Class: "m5.large", VPC: true, Platform: "Windows"}
+		taggedA  = ec2Inst{Class: "m5.large", VPC: true, Tag: "a"}
+	)
+	tests := []struct {
+		name         string
+		ei, run, res map[ec2Inst]int
+		want         map[ec2Inst]int
+		wantLeft     []flexLeftover
+	}{
+		{
+			name: "large reservation covers several small instances",
+			ei:   map[ec2Inst]int{xlarge2: -1, large: 4},
+			run:  map[ec2Inst]int{large: 4},
+			res:  map[ec2Inst]int{xlarge2: 1},
+			want: map[ec2Inst]int{xlarge2: 0, large: 0},
+		},
+		{
+			name:     "small reservation partially covers large instance",
+			ei:       map[ec2Inst]int{xlarge: 1, large: -1},
+			run:      map[ec2Inst]int{xlarge: 1},
+			res:      map[ec2Inst]int{large: 1},
+			want:     map[ec2Inst]int{xlarge: 1, large: 0},
+			wantLeft: []flexLeftover{{ec2Inst: xlarge, Fraction: 0.5, Covered: true}},
+		},
+		{
+			name:     "leftover fraction of reservation",
+			ei:       map[ec2Inst]int{xlarge2: -1, xlarge: 1},
+			run:      map[ec2Inst]int{xlarge: 1},
+			res:      map[ec2Inst]int{xlarge2: 1},
+			want:     map[ec2Inst]int{xlarge2: 0, xlarge: 0},
+			wantLeft: []flexLeftover{{ec2Inst: xlarge2, Fraction: 0.5}},
+		},
+		{
+			name: "other platforms are not merged",
+			ei:   map[ec2Inst]int{xlarge: -1, winLarge: 2},
+			run:  map[ec2Inst]int{},
+			res:  map[ec2Inst]int{xlarge: 1},
+			want: map[ec2Inst]int{xlarge: -1, winLarge: 2},
+		},
+		{
+			name: "tag groups are merged",
+			ei:   map[ec2Inst]int{xlarge: -1, taggedA: 2},
+			run:  map[ec2Inst]int{taggedA: 2},
+			res:  map[ec2Inst]int{xlarge: 1},
+			want: map[ec2Inst]int{xlarge: 0, taggedA: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left := settleSizeFlexible(tt.ei, tt.run, tt.res)
+			if !reflect.DeepEqual(tt.ei, tt.want) {
+				t.Errorf("ei = %v, want %v", tt.ei, tt.want)
+			}
+			if !reflect.DeepEqual(left, tt.wantLeft) {
+				t.Errorf("leftovers = %+v, want %+v", left, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestSettleRDSSizeFlexible(t *testing.T) {
+	var (
+		pgLarge        = rdsInst{Class: "db.r5.large", Product: "postgresql"}
+		pgXlarge       = rdsInst{Class: "db.r5.xlarge", Product: "postgresql"}
+		pgLargeMultiAZ = rdsInst{Class: "db.r5.large", Product: "postgresql", MultiAZ: true}
+		mysqlLarge     = rdsInst{Class: "db.r5.large", Product: "mysql"}
+		sqlLarge       = rdsInst{Class: "db.r5.large", Product: "sqlserver-se", LicenseModel: "li"}
+		sqlXlarge      = rdsInst{Class: "db.r5.xlarge", Product: "sqlserver-se", LicenseModel: "li"}
+	)
+	tests := []struct {
+		name     string
+		ri       map[rdsInst]int
+		multiAZ  bool
+		want     map[rdsInst]int
+		wantLeft []rdsFlexLeftover
+	}{
+		{
+			name: "large reservation covers several small instances",
+			ri:   map[rdsInst]int{pgXlarge: -1, pgLarge: 2},
+			want: map[rdsInst]int{pgXlarge: 0, pgLarge: 0},
+		},
+		{
+			name:     "small reservation partially covers large instance",
+			ri:       map[rdsInst]int{pgXlarge: 1, pgLarge: -1},
+			want:     map[rdsInst]int{pgXlarge: 1, pgLarge: 0},
+			wantLeft: []rdsFlexLeftover{{rdsInst: pgXlarge, Fraction: 0.5, Covered: true}},
+		},
+		{
+			name:     "leftover fraction of reservation",
+			ri:       map[rdsInst]int{pgXlarge: -1, pgLarge: 1},
+			want:     map[rdsInst]int{pgXlarge: 0, pgLarge: 0},
+			wantLeft: []rdsFlexLeftover{{rdsInst: pgXlarge, Fraction: 0.5}},
+		},
+		{
+			name: "other engines are not merged",
+			ri:   map[rdsInst]int{pgXlarge: -1, mysqlLarge: 2},
+			want: map[rdsInst]int{pgXlarge: -1, mysqlLarge: 2},
+		},
+		{
+			name: "license included reservations are not size flexible",
+			ri:   map[rdsInst]int{sqlXlarge: -1, sqlLarge: 2},
+			want: map[rdsInst]int{sqlXlarge: -1, sqlLarge: 2},
+		},
+		{
+			name: "deployments are not merged by default",
+			ri:   map[rdsInst]int{pgLarge: -2, pgLargeMultiAZ: 1},
+			want: map[rdsInst]int{pgLarge: -2, pgLargeMultiAZ: 1},
+		},
+		{
+			name:    "Single-AZ reservations cover Multi-AZ instance",
+			ri:      map[rdsInst]int{pgLarge: -2, pgLargeMultiAZ: 1},
+			multiAZ: true,
+			want:    map[rdsInst]int{pgLarge: 0, pgLargeMultiAZ: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left := settleRDSSizeFlexible(tt.ri, tt.multiAZ)
+			if !reflect.DeepEqual(tt.ri, tt.want) {
+				t.Errorf("ri = %v, want %v", tt.ri, tt.want)
+			}
+			if !reflect.DeepEqual(left, tt.wantLeft) {
+				t.Errorf("leftovers = %+v, want %+v", left, tt.wantLeft)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/aws-go/aws"
+)
+
+// errNoSSO is returned by newSSOCreds if profile has no IAM Identity Center
+// (SSO) settings
+var errNoSSO = errors.New("profile has no SSO settings")
+
+// ssoCreds provides role credentials of IAM Identity Center (SSO) profile of
+// shared config file, using access token cached by "aws sso login"
+type ssoCreds struct {
+	StartURL string
+	Region   string // region of IAM Identity Center
+	Account  string
+	Role     string
+	CacheKey string // session name, or start URL for legacy profiles
+
+	mu    sync.Mutex
+	creds *aws.Credentials
+	exp   time.Time
+}
+
+// newSSOCreds returns ssoCreds of profile from shared config file (AWS_PROFILE
+// or default, if profile is empty), or errNoSSO if profile is not SSO one
+func newSSOCreds(profile string) (*ssoCreds, error) {
+	if profile == "" {
+		profile = "default"
+	}
+	name := os.Getenv("AWS_CONFIG_FILE")
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.Join(home, ".aws", "config")
+	}
+	cfg, err := readConfigFile(name)
+	if err != nil {
+		return nil, err
+	}
+	section := "profile " + profile
+	if profile == "default" && cfg[section] == nil {
+		section = "default"
+	}
+	p := cfg[section]
+	if p == nil {
+		return nil, fmt.Errorf("no profile %q in %s", profile, name)
+	}
+	out := &ssoCreds{
+		StartURL: p["sso_start_url"],
+		Region:   p["sso_region"],
+		Account:  p["sso_account_id"],
+		Role:     p["sso_role_name"],
+		CacheKey: p["sso_start_url"],
+	}
+	if s := p["sso_session"]; s != "" {
+		sess := cfg["sso-session "+s]
+		if sess == nil {
+			return nil, fmt.Errorf("no sso-session %q in %s", s, name)
+		}
+		out.StartURL, out.Region, out.CacheKey = sess["sso_start_url"], sess["sso_region"], s
+	}
+	if out.StartURL == "" && out.Account == "" {
+		return nil, errNoSSO
+	}
+	if out.StartURL == "" || out.Region == "" || out.Account == "" || out.Role == "" {
+		return nil, fmt.Errorf("profile %q has incomplete SSO settings", profile)
+	}
+	return out, nil
+}
+
+func (p *ssoCreds) Credentials() (*aws.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.creds != nil && time.Now().Add(time.Minute).Before(p.exp) {
+		return p.creds, nil
+	}
+	token, err := p.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	u := "https://portal.sso." + p.Region + ".amazonaws.com/federation/credentials?" +
+		url.Values{"account_id": {p.Account}, "role_name": {p.Role}}.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-amz-sso_bearer_token", token)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SSO portal returned %s, try \"aws sso login\"", resp.Status)
+	}
+	var out struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"` // milliseconds since epoch
+		} `json:"roleCredentials"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	rc := out.RoleCredentials
+	p.creds = &aws.Credentials{
+		AccessKeyID:     rc.AccessKeyID,
+		SecretAccessKey: rc.SecretAccessKey,
+		SecurityToken:   rc.SessionToken,
+	}
+	p.exp = time.Unix(0, rc.Expiration*int64(time.Millisecond))
+	return p.creds, nil
+}
+
+// accessToken returns access token "aws sso login" cached for profile
+func (p *ssoCreds) accessToken() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(p.CacheKey))
+	b, err := os.ReadFile(filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json"))
+	if os.IsNotExist(err) {
+		return "", errors.New("no cached SSO token, run \"aws sso login\"")
+	}
+	if err != nil {
+		return "", err
+	}
+	var cached struct {
+		AccessToken string    `json:"accessToken"`
+		ExpiresAt   time.Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return "", err
+	}
+	if !time.Now().Before(cached.ExpiresAt) {
+		return "", errors.New("cached SSO token expired, run \"aws sso login\"")
+	}
+	return cached.AccessToken, nil
+}
+
+// readConfigFile reads ini-style AWS shared config file into key-value pairs
+// by section name
+func readConfigFile(name string) (map[string]map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := make(map[string]map[string]string)
+	var section map[string]string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "", line[0] == '#', line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			section = make(map[string]string)
+			out[name] = section
+		case section != nil:
+			if i := strings.IndexByte(line, '='); i > 0 {
+				section[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stripe/aws-go/gen/ec2"
+)
+
+// tagFilter selects resources by tag; zero value selects everything
+type tagFilter struct {
+	Key   string
+	Value string // if empty, any resource having Key tag matches
+}
+
+// parseTagFilter parses tag filter in key=value or key form
+func parseTagFilter(s string) (tagFilter, error) {
+	if s == "" {
+		return tagFilter{}, nil
+	}
+	f := tagFilter{Key: s}
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		f.Key, f.Value = s[:i], s[i+1:]
+	}
+	if f.Key == "" {
+		return tagFilter{}, fmt.Errorf("invalid tag filter %q, want key=value or key", s)
+	}
+	return f, nil
+}
+
+func (f tagFilter) match(tags map[string]string) bool {
+	if f.Key == "" {
+		return true
+	}
+	v, ok := tags[f.Key]
+	return ok && (f.Value == "" || v == f.Value)
+}
+
+// emrClusterTag is set by EMR on instances of its clusters to cluster id
+const emrClusterTag = "aws:elasticmapreduce:job-flow-id"
+
+// emrKey groups instances of EMR clusters
+type emrKey struct {
+	Class   string // instance class
+	Cluster string // EMR cluster id
+}
+
+// containerCluster returns name of ECS or EKS cluster instance is a node of,
+// as found in tags set by EKS managed node groups, eksctl, Kubernetes cloud
+// provider and ECS; empty string is returned for other instances.
+func containerCluster(tags map[string]string) string {
+	for _, k := range []string{"eks:cluster-name", "alpha.eksctl.io/cluster-name"} {
+		if v := tags[k]; v != "" {
+			return "eks:" + v
+		}
+	}
+	const k8sPrefix = "kubernetes.io/cluster/"
+	var k8s []string
+	for k := range tags {
+		if strings.HasPrefix(k, k8sPrefix) && len(k) > len(k8sPrefix) {
+			k8s = append(k8s, k[len(k8sPrefix):])
+		}
+	}
+	if len(k8s) > 0 {
+		sort.Strings(k8s)
+		return "eks:" + k8s[0]
+	}
+	if v := tags["aws:ecs:clusterName"]; v != "" {
+		return "ecs:" + v
+	}
+	// instances of ECS capacity providers with managed scaling
+	if _, ok := tags["AmazonECSManaged"]; ok {
+		return "ecs"
+	}
+	return ""
+}
+
+// tagMap converts ec2 tags to map; nil is returned if there are no tags
+func tagMap(tags []ec2.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(tags))
+	for _, t := range tags {
+		out[toStr(t.Key)] = toStr(t.Value)
+	}
+	return out
+}
+
+// settleTagGroups lets unused reservations of one tag group cover on-demand
+// instances of other groups after reservations were matched within their own
+// groups first, as AWS billing does not take tags into account.
+func settleTagGroups(ei map[ec2Inst]int) {
+	groups := make(map[ec2Inst][]ec2Inst)
+	for k := range ei {
+		base := k
+		base.Tag = ""
+		groups[base] = append(groups[base], k)
+	}
+	for _, keys := range groups {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Tag < keys[j].Tag })
+		for _, a := range keys {
+			for _, b := range keys {
+				if ei[a] <= 0 || ei[b] >= 0 {
+					continue
+				}
+				n := ei[a]
+				if -ei[b] < n {
+					n = -ei[b]
+				}
+				ei[a] -= n
+				ei[b] += n
+			}
+		}
+	}
+}
+
+// stringTag returns tag group as an extra tab separated column, or empty
+// string if tag matching is not used
+func stringTag(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "\t" + s
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// telemetryEnv names environment variable setting -telemetry endpoint, so
+// that it can be enabled for all runs on a host without changing command line
+const telemetryEnv = "AWS_RESERVATIONS_TELEMETRY"
+
+// usageReport is anonymous usage data sent to -telemetry endpoint. It only
+// holds names of flags used and number of resources scanned, never their
+// values, identifiers or account details.
+type usageReport struct {
+	Version  string         `json:"version"`
+	Command  string         `json:"command"`
+	Flags    []string       `json:"flags"`
+	Scanned  map[string]int `json:"scanned"`
+	Duration float64        `json:"duration"` // seconds
+}
+
+// telemetryEndpoint returns endpoint to send usage reports to: flag value if
+// it's set, otherwise value of telemetryEnv environment variable. Reports are
+// never sent if DO_NOT_TRACK environment variable is set, or endpoint is
+// "off", which allows to disable them for a single run.
+func telemetryEndpoint(flagValue string) string {
+	if os.Getenv("DO_NOT_TRACK") != "" {
+		return ""
+	}
+	v := flagValue
+	if v == "" {
+		v = os.Getenv(telemetryEnv)
+	}
+	if v == "off" {
+		return ""
+	}
+	return v
+}
+
+// newUsageReport returns usageReport for current run, filling in command and
+// names of flags set on command line
+func newUsageReport(scanned map[string]int, started time.Time) usageReport {
+	r := usageReport{
+		Version:  version,
+		Command:  flag.Arg(0),
+		Flags:    []string{},
+		Scanned:  scanned,
+		Duration: time.Since(started).Seconds(),
+	}
+	flag.Visit(func(f *flag.Flag) { r.Flags = append(r.Flags, f.Name) })
+	return r
+}
+
+// sendUsageReport posts r as JSON to endpoint
+func sendUsageReport(endpoint string, r usageReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
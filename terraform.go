@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var driftfmt = "%20s\t%5s\t%9s\t%6d iac\t%6d live\t%6d reserved\n"
+
+// readTerraformState reads EC2 instances declared as aws_instance resources
+// from Terraform state file (format version 4, written by Terraform 0.12 and
+// later). Only instances in region are returned, region is derived from
+// instance availability zone.
+func readTerraformState(name, region string) (map[ec2Inst]int, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var state struct {
+		Version   int `json:"version"`
+		Resources []struct {
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Instances []struct {
+				Attributes struct {
+					InstanceType string `json:"instance_type"`
+					Zone         string `json:"availability_zone"`
+					SubnetID     string `json:"subnet_id"`
+					Tenancy      string `json:"tenancy"`
+				} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("%s: unsupported state version %d, want 4", name, state.Version)
+	}
+	out := make(map[ec2Inst]int)
+	for _, r := range state.Resources {
+		if r.Mode != "managed" || r.Type != "aws_instance" {
+			continue
+		}
+		for _, inst := range r.Instances {
+			a := inst.Attributes
+			if a.InstanceType == "" || !strings.HasPrefix(a.Zone, region) {
+				continue
+			}
+			out[ec2Inst{Class: a.InstanceType, VPC: a.SubnetID != "", Tenancy: ec2Tenancy(a.Tenancy)}]++
+		}
+	}
+	return out, nil
+}
+
+// printDrift prints instance groups where counts declared in Terraform state,
+// running and reserved differ. Keys of declared have no platform, as state
+// does not tell it, so live and reserved must be keyed without it too.
+func printDrift(declared, live, reserved map[ec2Inst]int) {
+	keys := make(map[ec2Inst]struct{})
+	for _, m := range []map[ec2Inst]int{declared, live, reserved} {
+		for k := range m {
+			keys[k] = struct{}{}
+		}
+	}
+	var sorted []ec2Inst
+	for k := range keys {
+		if declared[k] == live[k] && live[k] == reserved[k] {
+			continue
+		}
+		sorted = append(sorted, k)
+	}
+	if len(sorted) == 0 {
+		return
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Class != sorted[j].Class {
+			return sorted[i].Class < sorted[j].Class
+		}
+		if sorted[i].VPC != sorted[j].VPC {
+			return !sorted[i].VPC
+		}
+		return sorted[i].Tenancy < sorted[j].Tenancy
+	})
+	fmt.Println("\nDrift between Terraform state, live instances and reservations:")
+	for _, k := range sorted {
+		fmt.Printf(driftfmt, k.Class, stringVPC(k.VPC), stringTenancy(k.Tenancy), declared[k], live[k], reserved[k])
+	}
+}